@@ -0,0 +1,181 @@
+package main
+
+import (
+    "context"
+    "flag"
+    "fmt"
+    "os"
+    "path/filepath"
+    "strings"
+    "text/tabwriter"
+
+    "github.com/origamizyt/isfj"
+)
+
+type language struct {
+    compiler    string
+    diagnostics isfj.DiagnosticParser
+}
+
+var languages = map[string]language{
+    "c": { `gcc -O2 -o "{{ .Output }}" -x c "{{ .Source }}" -lm`, isfj.ParseGCCDiagnostics },
+    "cpp": { `g++ -O2 -o "{{ .Output }}" -x c++ "{{ .Source }}"`, isfj.ParseGCCDiagnostics },
+    "rust": { `rustc -O --error-format=json -o "{{ .Output }}" "{{ .Source }}"`, isfj.ParseRustcDiagnostics },
+}
+
+var extensions = map[string]string{
+    ".c": "c",
+    ".cc": "cpp",
+    ".cpp": "cpp",
+    ".cxx": "cpp",
+    ".rs": "rust",
+}
+
+type caseOutput struct {
+    Case    int             `json:"case"`
+    Name    string          `json:"name"`
+    Status  string          `json:"status"`
+    Usages  usagesOutput    `json:"usages"`
+    Points  int             `json:"points"`
+    Extra   string          `json:"extra,omitempty"`
+}
+
+type judgeOutput struct {
+    Status      string          `json:"status"`
+    Points      int             `json:"points"`
+    CompilerLog string          `json:"compilerLog"`
+    Cases       []caseOutput    `json:"cases"`
+}
+
+func judge(args []string) int {
+    flags := flag.NewFlagSet("judge", flag.ExitOnError)
+    flags.Usage = func() {
+        fmt.Fprintln(flags.Output(), "Usage: isfj judge [flags] <source> <problem>")
+        fmt.Fprintln(flags.Output(), "The problem is a directory or zip file, see isfj.LoadProblem.")
+        fmt.Fprintln(flags.Output(), "Flags override the problem manifest when given.")
+        flags.PrintDefaults()
+    }
+    lang := flags.String("lang", "", "language: c, cpp or rust (default: from the file extension)")
+    compilerTemplate := flags.String("compiler", "", "compiler command template, overrides the language's")
+    needle := flags.String("needle", "", "needle library to inject")
+    strict := flags.Bool("strict", false, "compare outputs strictly instead of ignoring whitespace")
+    points := flags.Int("points", -1, "points of each case")
+    jsonOutput := flags.Bool("json", false, "print the result as JSON")
+    var limits limitFlags
+    limits.register(flags)
+    flags.Parse(args)
+    if flags.NArg() != 2 {
+        flags.Usage()
+        return 2
+    }
+    source := flags.Arg(0)
+
+    if *lang == "" {
+        *lang = extensions[filepath.Ext(source)]
+    }
+    l, ok := languages[*lang]
+    if *compilerTemplate != "" {
+        l = language{ compiler: *compilerTemplate }
+    } else if !ok {
+        return fail(fmt.Errorf("unknown language %q, use -lang or -compiler", *lang))
+    }
+    compiler, err := isfj.NewCompiler(l.compiler)
+    if err != nil {
+        return fail(err)
+    }
+    compiler.Diagnostics = l.diagnostics
+    if *needle != "" {
+        if *needle, err = filepath.Abs(*needle); err != nil {
+            return fail(err)
+        }
+    }
+
+    code, err := os.ReadFile(source)
+    if err != nil {
+        return fail(err)
+    }
+    problem, err := isfj.LoadProblem(flags.Arg(1))
+    if err != nil {
+        return fail(err)
+    }
+
+    tempDir, err := os.MkdirTemp("", "isfj-")
+    if err != nil {
+        return fail(err)
+    }
+    defer os.RemoveAll(tempDir)
+    engine := isfj.NewEngine(tempDir)
+    engine.AddCompiler(*lang, compiler)
+    engine.AddProblemJudger(problem)
+    if err := engine.SpawnWorkers(1); err != nil {
+        return fail(err)
+    }
+    defer engine.Shutdown(context.Background())
+
+    init := problem.JobInit(string(code), *lang)
+    for i := range init.Cases {
+        limits.override(&init.Cases[i].Limits)
+        if *points >= 0 {
+            init.Cases[i].Points = *points
+        }
+    }
+    if *strict {
+        init.Mode = isfj.J_STRICT
+    }
+    if *needle != "" {
+        init.Needle = *needle
+    }
+    task, err := engine.Schedule(isfj.NewJob(init))
+    if err != nil {
+        return fail(err)
+    }
+    job, _ := task.Wait(context.Background())
+
+    output := judgeOutput{
+        Status: job.Status.Ident(),
+        CompilerLog: job.Results[0].Extra,
+    }
+    for i, result := range job.Results[1:] {
+        output.Points += result.Points
+        output.Cases = append(output.Cases, caseOutput{
+            Case: i+1,
+            Name: problem.Tests[i],
+            Status: result.Status.Ident(),
+            Usages: newUsagesOutput(result.Usages),
+            Points: result.Points,
+            Extra: result.Extra,
+        })
+    }
+    if *jsonOutput {
+        printJSON(output)
+    } else {
+        printJudgeTable(job, output)
+    }
+    if job.Status != isfj.ST_ACCEPTED {
+        return 1
+    }
+    return 0
+}
+
+func printJudgeTable(job isfj.Job, output judgeOutput) {
+    if output.CompilerLog != "" {
+        fmt.Fprintln(os.Stderr, strings.TrimRight(output.CompilerLog, "\n"))
+    }
+    if job.Results[0].Status != isfj.ST_COMPILATION_SUCCESS {
+        fmt.Println(job.Results[0].Status)
+        return
+    }
+    w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+    fmt.Fprintln(w, "CASE\tNAME\tSTATUS\tTIME\tMEMORY\tPOINTS")
+    for i, c := range output.Cases {
+        fmt.Fprintf(w, "%d\t%s\t%s\t%.1f ms\t%d KiB\t%d\n",
+            c.Case, c.Name, job.Results[i+1].Status, c.Usages.TimeMs, c.Usages.MemoryKiB, c.Points)
+    }
+    w.Flush()
+    fmt.Printf("\n%s, %d points\n", job.Status, output.Points)
+    for _, c := range output.Cases {
+        if c.Extra != "" {
+            fmt.Fprintf(os.Stderr, "case %d: %s\n", c.Case, c.Extra)
+        }
+    }
+}
@@ -0,0 +1,117 @@
+// Command isfj judges submissions locally.
+//
+// Usage:
+//
+//	isfj judge [flags] <source> <problem>
+//	isfj run [flags] <executable> [args...]
+//	isfj needle [flags] <rules> <output>
+//
+// Run "isfj <command> -h" for the flags of each command.
+package main
+
+import (
+    "encoding/json"
+    "flag"
+    "fmt"
+    "os"
+    "time"
+
+    "github.com/origamizyt/isfj"
+)
+
+const usage = `Usage:
+    isfj judge [flags] <source> <problem>
+        Judges a source file against a problem directory or zip file.
+    isfj run [flags] <executable> [args...]
+        Runs a program once in the sandbox and prints its usages.
+    isfj needle [flags] <rules> <output>
+        Compiles a needle from a YAML or JSON syscall rules file.
+`
+
+func main() {
+    if len(os.Args) < 2 {
+        fmt.Fprint(os.Stderr, usage)
+        os.Exit(2)
+    }
+    var code int
+    switch os.Args[1] {
+        case "judge":
+            code = judge(os.Args[2:])
+        case "run":
+            code = run(os.Args[2:])
+        case "needle":
+            code = needle(os.Args[2:])
+        case "-h", "-help", "--help", "help":
+            fmt.Fprint(os.Stdout, usage)
+        default: {
+            fmt.Fprintf(os.Stderr, "unknown command %q\n%s", os.Args[1], usage)
+            code = 2
+        }
+    }
+    os.Exit(code)
+}
+
+// Prints an error and returns the exit code for failures.
+func fail(err error) int {
+    fmt.Fprintln(os.Stderr, "isfj:", err)
+    return 2
+}
+
+func printJSON(value any) {
+    encoder := json.NewEncoder(os.Stdout)
+    encoder.SetIndent("", "  ")
+    encoder.Encode(value)
+}
+
+// Flags shared by judge & run.
+type limitFlags struct {
+    time    time.Duration
+    stack   uint64
+    heap    uint64
+    memory  uint64
+}
+
+func (l *limitFlags) register(flags *flag.FlagSet) {
+    flags.DurationVar(&l.time, "time", 0, "time limit, e.g. 1s (0 means unlimited)")
+    flags.Uint64Var(&l.stack, "stack", 0, "stack memory limit in MiB (0 means unlimited)")
+    flags.Uint64Var(&l.heap, "heap", 0, "heap memory limit in MiB (0 means unlimited)")
+    flags.Uint64Var(&l.memory, "memory", 0, "stack + heap memory limit in MiB (0 means unlimited)")
+}
+
+// Replaces limits given by flags.
+func (l *limitFlags) override(limits *isfj.Limits) {
+    if l.time != 0 {
+        limits.Time = uint64(l.time.Microseconds())
+    }
+    if l.stack != 0 {
+        limits.StackMemory = l.stack << 20
+    }
+    if l.heap != 0 {
+        limits.HeapMemory = l.heap << 20
+    }
+    if l.memory != 0 {
+        limits.Memory = l.memory << 20
+    }
+}
+
+func (l *limitFlags) limits() isfj.Limits {
+    return isfj.Limits{
+        Time: uint64(l.time.Microseconds()),
+        StackMemory: l.stack << 20,
+        HeapMemory: l.heap << 20,
+        Memory: l.memory << 20,
+    }
+}
+
+// Usages in units people read.
+type usagesOutput struct {
+    TimeMs      float64 `json:"timeMs"`
+    MemoryKiB   uint64  `json:"memoryKiB"`
+}
+
+func newUsagesOutput(u isfj.Usages) usagesOutput {
+    return usagesOutput{
+        TimeMs: float64(u.Time) / 1000,
+        MemoryKiB: u.Memory >> 10,
+    }
+}
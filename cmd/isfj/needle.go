@@ -0,0 +1,119 @@
+package main
+
+import (
+    "bytes"
+    "encoding/json"
+    "flag"
+    "fmt"
+    "os"
+    "path/filepath"
+    "strings"
+
+    "github.com/origamizyt/isfj"
+    "gopkg.in/yaml.v3"
+)
+
+// Syscall rules as written in files, e.g.
+//
+//	mode: blacklist
+//	actions:
+//	  - syscall: 435
+//	    deduction: 0
+type rulesFile struct {
+    // "blacklist" or "whitelist".
+    Mode    string          `json:"mode" yaml:"mode"`
+    Actions []actionFile    `json:"actions" yaml:"actions"`
+}
+
+type actionFile struct {
+    Syscall     int `json:"syscall" yaml:"syscall"`
+    Deduction   int `json:"deduction" yaml:"deduction"`
+}
+
+// Reads rules from a .json, .yaml or .yml file.
+func loadRules(path string) (isfj.SyscallRules, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return isfj.SyscallRules{}, err
+    }
+    var file rulesFile
+    switch strings.ToLower(filepath.Ext(path)) {
+        case ".json": {
+            decoder := json.NewDecoder(bytes.NewReader(data))
+            decoder.DisallowUnknownFields()
+            err = decoder.Decode(&file)
+        }
+        case ".yaml", ".yml": {
+            decoder := yaml.NewDecoder(bytes.NewReader(data))
+            decoder.KnownFields(true)
+            err = decoder.Decode(&file)
+        }
+        default:
+            err = fmt.Errorf("unknown rules format %q, expected .json, .yaml or .yml", filepath.Ext(path))
+    }
+    if err != nil {
+        return isfj.SyscallRules{}, fmt.Errorf("%s: %w", path, err)
+    }
+    rules := isfj.SyscallRules{}
+    switch file.Mode {
+        case "blacklist":
+            rules.Mode = isfj.RM_BLACKLIST
+        case "whitelist":
+            rules.Mode = isfj.RM_WHITELIST
+        default:
+            return rules, fmt.Errorf("%s: mode must be blacklist or whitelist, got %q", path, file.Mode)
+    }
+    for _, action := range file.Actions {
+        rules.Actions = append(rules.Actions, isfj.SyscallAction{
+            Syscall: action.Syscall,
+            Deduction: action.Deduction,
+        })
+    }
+    return rules, nil
+}
+
+func needle(args []string) int {
+    flags := flag.NewFlagSet("needle", flag.ExitOnError)
+    flags.Usage = func() {
+        fmt.Fprintln(flags.Output(), "Usage: isfj needle [flags] <rules> <output>")
+        fmt.Fprintln(flags.Output(), "Rules are read from a .json, .yaml or .yml file, e.g.")
+        fmt.Fprintln(flags.Output(), "    mode: blacklist")
+        fmt.Fprintln(flags.Output(), "    actions:")
+        fmt.Fprintln(flags.Output(), "      - syscall: 435")
+        fmt.Fprintln(flags.Output(), "        deduction: 0")
+        flags.PrintDefaults()
+    }
+    command := flags.String("cc", "gcc -o {{ .Output }} -fPIC -shared -x c -", "compiler command template, reading code from stdin")
+    jsonOutput := flags.Bool("json", false, "print the result as JSON")
+    flags.Parse(args)
+    if flags.NArg() != 2 {
+        flags.Usage()
+        return 2
+    }
+    rules, err := loadRules(flags.Arg(0))
+    if err != nil {
+        return fail(err)
+    }
+    output, err := filepath.Abs(flags.Arg(1))
+    if err != nil {
+        return fail(err)
+    }
+    err = isfj.CompileNeedleLibrary(rules, *command, output)
+    if *jsonOutput {
+        result := map[string]any{ "output": output, "rules": len(rules.Actions) }
+        if err != nil {
+            result["error"] = err.Error()
+        }
+        printJSON(result)
+    }
+    if err != nil {
+        if !*jsonOutput {
+            fmt.Fprintln(os.Stderr, "isfj:", err)
+        }
+        return 1
+    }
+    if !*jsonOutput {
+        fmt.Printf("%s: %d rules\n", output, len(rules.Actions))
+    }
+    return 0
+}
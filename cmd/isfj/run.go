@@ -0,0 +1,95 @@
+package main
+
+import (
+    "flag"
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+
+    "github.com/origamizyt/isfj"
+)
+
+type runOutput struct {
+    Status      string          `json:"status"`
+    ExitInfo    int             `json:"exitInfo"`
+    Usages      usagesOutput    `json:"usages"`
+    Deduction   int             `json:"deduction"`
+    Stdout      string          `json:"stdout"`
+    Error       string          `json:"error,omitempty"`
+}
+
+func run(args []string) int {
+    flags := flag.NewFlagSet("run", flag.ExitOnError)
+    flags.Usage = func() {
+        fmt.Fprintln(flags.Output(), "Usage: isfj run [flags] <executable> [args...]")
+        fmt.Fprintln(flags.Output(), "The program's output goes to stdout, its usages to stderr.")
+        flags.PrintDefaults()
+    }
+    needle := flags.String("needle", "", "needle library to inject")
+    stdin := flags.String("stdin", "", "file to feed to the program (default: stdin)")
+    jsonOutput := flags.Bool("json", false, "print the result, including the output, as JSON")
+    var limits limitFlags
+    limits.register(flags)
+    flags.Parse(args)
+    if flags.NArg() < 1 {
+        flags.Usage()
+        return 2
+    }
+
+    var input []byte
+    var err error
+    if *stdin != "" {
+        input, err = os.ReadFile(*stdin)
+    } else {
+        input, err = io.ReadAll(os.Stdin)
+    }
+    if err != nil {
+        return fail(err)
+    }
+    executable, err := filepath.Abs(flags.Arg(0))
+    if err != nil {
+        return fail(err)
+    }
+    if *needle != "" {
+        if *needle, err = filepath.Abs(*needle); err != nil {
+            return fail(err)
+        }
+    }
+    result := isfj.Run(isfj.RunnerInput{
+        Executable: executable,
+        Arguments: flags.Args()[1:],
+        NeedleLib: *needle,
+        Stdin: string(input),
+        Limits: limits.limits(),
+    })
+
+    output := runOutput{
+        Status: result.Status.Ident(),
+        ExitInfo: result.ExitInfo,
+        Usages: newUsagesOutput(result.Usages),
+        Deduction: result.Deduction,
+        Stdout: result.Stdout,
+    }
+    if result.Err != nil {
+        output.Error = result.Err.Error()
+    }
+    if *jsonOutput {
+        printJSON(output)
+    } else {
+        os.Stdout.WriteString(result.Stdout)
+        fmt.Fprintf(os.Stderr, "%s (exit info %d): %.1f ms, %d KiB",
+            result.Status, result.ExitInfo, output.Usages.TimeMs, output.Usages.MemoryKiB)
+        if result.Deduction != 0 {
+            fmt.Fprintf(os.Stderr, ", %d points deducted", result.Deduction)
+        }
+        fmt.Fprintln(os.Stderr)
+        if result.Err != nil {
+            fmt.Fprintln(os.Stderr, result.Err)
+        }
+    }
+    if result.Status != isfj.ST_ACCEPTED {
+        return 1
+    }
+    return 0
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "os"
+    "path/filepath"
+    "time"
+
+    "github.com/origamizyt/isfj"
+)
+
+// Duration that can be read from strings like "1h30m".
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+    var s string
+    if err := json.Unmarshal(data, &s); err != nil {
+        return err
+    }
+    v, err := time.ParseDuration(s)
+    if err != nil {
+        return err
+    }
+    *d = Duration(v)
+    return nil
+}
+
+type CompilerConfig struct {
+    // Command template, see [isfj.NewCompiler].
+    Command     string  `json:"command"`
+    // One of "gcc", "javac", "rustc" & "python", may be empty.
+    Diagnostics string  `json:"diagnostics"`
+    OutputLimit int     `json:"outputLimit"`
+}
+
+// Exactly one of External & Lua should be set.
+type JudgerConfig struct {
+    // Command template, see [isfj.NewExternalJudger].
+    External    string  `json:"external"`
+    // Path to a Lua script, see [isfj.NewLuaJudger].
+    Lua         string  `json:"lua"`
+}
+
+type Config struct {
+    Listen          string                      `json:"listen"`
+    TempDir         string                      `json:"tempDir"`
+    Workers         int                         `json:"workers"`
+    QueueCapacity   int                         `json:"queueCapacity"`
+    CPUSlots        int                         `json:"cpuSlots"`
+    // Overrides CPUSlots if not empty.
+    CPUCores        []int                       `json:"cpuCores"`
+    FairShare       bool                        `json:"fairShare"`
+    // Path of the task log, see [isfj.OpenFileStore].
+    // Empty means tasks are not persisted.
+    Store           string                      `json:"store"`
+    // Finished tasks kept for lookups, 10000 by default.
+    // Set maxCount to 0 for no limit.
+    Retention       struct {
+        MaxAge      Duration                    `json:"maxAge"`
+        MaxCount    int                         `json:"maxCount"`
+    }                                           `json:"retention"`
+    // Maximum size of request bodies, in bytes.
+    MaxRequestBytes int64                       `json:"maxRequestBytes"`
+    // Accepted API keys. Empty means no authentication.
+    APIKeys         []string                    `json:"apiKeys"`
+    // Serve Prometheus metrics at /metrics.
+    Metrics         bool                        `json:"metrics"`
+    ShutdownTimeout Duration                    `json:"shutdownTimeout"`
+    Compilers       map[string]CompilerConfig   `json:"compilers"`
+    // Special judger i has judger id i.
+    Judgers         []JudgerConfig              `json:"judgers"`
+    // Needle names, which jobs refer to, mapped to paths.
+    // The needle named "default" is used when a job names none.
+    Needles         map[string]string           `json:"needles"`
+}
+
+func LoadConfig(path string) (*Config, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+    config := &Config{
+        Listen: ":8080",
+        TempDir: filepath.Join(os.TempDir(), "isfjd"),
+        Workers: 1,
+        MaxRequestBytes: 1 << 20,
+        ShutdownTimeout: Duration(time.Minute),
+    }
+    // finished tasks must be kept for GET /tasks/{id}, but not forever
+    config.Retention.MaxCount = 10000
+    if err := json.Unmarshal(data, config); err != nil {
+        return nil, fmt.Errorf("parse %s: %w", path, err)
+    }
+    for name, needle := range config.Needles {
+        if !filepath.IsAbs(needle) {
+            return nil, fmt.Errorf("needle %s: path must be absolute", name)
+        }
+    }
+    return config, nil
+}
+
+var diagnosticParsers = map[string]isfj.DiagnosticParser{
+    "gcc": isfj.ParseGCCDiagnostics,
+    "javac": isfj.ParseJavacDiagnostics,
+    "rustc": isfj.ParseRustcDiagnostics,
+    "python": isfj.ParsePythonDiagnostics,
+}
+
+// Creates an engine with the compilers & judgers in the config.
+func (c *Config) NewEngine() (*isfj.Engine, error) {
+    engine := isfj.NewEngine(c.TempDir)
+    for lang, cc := range c.Compilers {
+        compiler, err := isfj.NewCompiler(cc.Command)
+        if err != nil {
+            return nil, fmt.Errorf("compiler %s: %w", lang, err)
+        }
+        if cc.Diagnostics != "" {
+            parser, ok := diagnosticParsers[cc.Diagnostics]
+            if !ok {
+                return nil, fmt.Errorf("compiler %s: unknown diagnostics %q", lang, cc.Diagnostics)
+            }
+            compiler.Diagnostics = parser
+        }
+        compiler.OutputLimit = cc.OutputLimit
+        engine.AddCompiler(lang, compiler)
+    }
+    for i, jc := range c.Judgers {
+        judger, err := jc.NewJudger()
+        if err != nil {
+            return nil, fmt.Errorf("judger %d: %w", i, err)
+        }
+        engine.AddJudger(judger)
+    }
+    engine.SetQueueCapacity(c.QueueCapacity)
+    if len(c.CPUCores) > 0 {
+        engine.SetCPUCores(c.CPUCores)
+    } else {
+        engine.SetCPUSlots(c.CPUSlots)
+    }
+    engine.SetFairShare(c.FairShare)
+    engine.SetRetention(isfj.RetentionPolicy{
+        MaxAge: time.Duration(c.Retention.MaxAge),
+        MaxCount: c.Retention.MaxCount,
+    })
+    return engine, nil
+}
+
+func (c JudgerConfig) NewJudger() (isfj.SpecialJudger, error) {
+    switch {
+        case c.External != "" && c.Lua == "":
+            return isfj.NewExternalJudger(c.External)
+        case c.Lua != "" && c.External == "": {
+            code, err := os.ReadFile(c.Lua)
+            if err != nil {
+                return nil, err
+            }
+            return isfj.NewLuaJudger(string(code))
+        }
+    }
+    return nil, errors.New("exactly one of external & lua must be set")
+}
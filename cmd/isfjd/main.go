@@ -0,0 +1,110 @@
+// Command isfjd serves an [isfj.Engine] over HTTP/JSON.
+//
+// Usage:
+//
+//	isfjd -config isfjd.json
+//
+// Endpoints:
+//
+//	POST /tasks               submit a JobInit, returns {"id": ...}
+//	GET  /tasks/{id}          snapshot of the job
+//	POST /tasks/{id}/cancel   cancel the task
+//	GET  /tasks/{id}/events   server-sent events of the task
+//	GET  /metrics             Prometheus metrics, if enabled
+package main
+
+import (
+    "context"
+    "errors"
+    "flag"
+    "log/slog"
+    "net/http"
+    "os"
+    "os/signal"
+    "syscall"
+    "time"
+
+    "github.com/origamizyt/isfj"
+)
+
+func main() {
+    configPath := flag.String("config", "isfjd.json", "path to the config file")
+    flag.Parse()
+    logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+    if err := run(*configPath, logger); err != nil {
+        logger.Error("exiting", slog.Any("error", err))
+        os.Exit(1)
+    }
+}
+
+func run(configPath string, logger *slog.Logger) error {
+    config, err := LoadConfig(configPath)
+    if err != nil {
+        return err
+    }
+    engine, err := config.NewEngine()
+    if err != nil {
+        return err
+    }
+    engine.SetLogger(logger)
+    server := NewServer(engine, config, logger)
+    if config.Metrics {
+        metrics := isfj.NewPrometheusMetrics()
+        engine.SetMetrics(metrics)
+        server.HandleMetrics(metrics)
+    }
+    if config.Store != "" {
+        store, err := isfj.OpenFileStore(config.Store)
+        if err != nil {
+            return err
+        }
+        defer store.Close()
+        if err := store.Compact(); err != nil {
+            return err
+        }
+        engine.SetStore(store)
+        tasks, err := engine.Recover()
+        if err != nil {
+            return err
+        }
+        for _, task := range tasks {
+            server.own(task)
+        }
+        logger.Info("recovered tasks", slog.Int("count", len(tasks)))
+    }
+    if err := engine.SpawnWorkers(config.Workers); err != nil {
+        return err
+    }
+
+    httpServer := &http.Server{
+        Addr: config.Listen,
+        Handler: server,
+        ReadHeaderTimeout: 10 * time.Second,
+    }
+    ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+    defer stop()
+    errs := make(chan error, 1)
+    go func() {
+        logger.Info("listening", slog.String("addr", config.Listen))
+        errs <- httpServer.ListenAndServe()
+    }()
+    select {
+        case err := <-errs:
+            return err
+        case <-ctx.Done():
+    }
+    logger.Info("shutting down")
+    shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Duration(config.ShutdownTimeout))
+    defer cancel()
+    // event streams would keep the server open
+    go httpServer.Shutdown(shutdownCtx)
+    unfinished := engine.Shutdown(shutdownCtx)
+    httpServer.Close()
+    if len(unfinished) > 0 {
+        logger.Warn("cancelled unfinished tasks", slog.Any("tasks", unfinished))
+    }
+    if err := <-errs; !errors.Is(err, http.ErrServerClosed) {
+        return err
+    }
+    return nil
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+    "crypto/subtle"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "log/slog"
+    "net/http"
+    "strconv"
+    "strings"
+    "sync"
+
+    "github.com/origamizyt/isfj"
+)
+
+// Serves the HTTP/JSON API of an engine.
+type Server struct {
+    engine  *isfj.Engine
+    config  *Config
+    logger  *slog.Logger
+    // Tasks which can still be cancelled.
+    lock    sync.Mutex
+    tasks   map[uint64]*isfj.Task
+    mux     *http.ServeMux
+}
+
+func NewServer(engine *isfj.Engine, config *Config, logger *slog.Logger) *Server {
+    s := &Server{
+        engine: engine,
+        config: config,
+        logger: logger,
+        tasks: map[uint64]*isfj.Task{},
+        mux: http.NewServeMux(),
+    }
+    s.mux.HandleFunc("POST /tasks", s.submit)
+    s.mux.HandleFunc("GET /tasks/{id}", s.status)
+    s.mux.HandleFunc("POST /tasks/{id}/cancel", s.cancel)
+    s.mux.HandleFunc("GET /tasks/{id}/events", s.events)
+    return s
+}
+
+// Serves metrics at /metrics.
+func (s *Server) HandleMetrics(metrics http.Handler) {
+    s.mux.Handle("GET /metrics", metrics)
+}
+
+// Keeps the task, so it can be cancelled until it finishes.
+func (s *Server) own(task *isfj.Task) {
+    s.lock.Lock()
+    s.tasks[task.Id()] = task
+    s.lock.Unlock()
+    go func() {
+        <-task.Done()
+        s.lock.Lock()
+        delete(s.tasks, task.Id())
+        s.lock.Unlock()
+    }()
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    if !s.authorized(r) {
+        w.Header().Set("WWW-Authenticate", "Bearer")
+        writeError(w, http.StatusUnauthorized, errors.New("invalid api key"))
+        return
+    }
+    r.Body = http.MaxBytesReader(w, r.Body, s.config.MaxRequestBytes)
+    s.mux.ServeHTTP(w, r)
+}
+
+// Accepts "Authorization: Bearer <key>" or "X-API-Key: <key>".
+func (s *Server) authorized(r *http.Request) bool {
+    if len(s.config.APIKeys) == 0 {
+        return true
+    }
+    key := r.Header.Get("X-API-Key")
+    if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+        key = bearer
+    }
+    if key == "" {
+        return false
+    }
+    authorized := false
+    for _, k := range s.config.APIKeys {
+        if subtle.ConstantTimeCompare([]byte(key), []byte(k)) == 1 {
+            authorized = true
+        }
+    }
+    return authorized
+}
+
+func writeJSON(w http.ResponseWriter, code int, value any) {
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(code)
+    json.NewEncoder(w).Encode(value)
+}
+
+type errorResponse struct {
+    Error   string  `json:"error"`
+    Field   string  `json:"field,omitempty"`
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+    response := errorResponse{ Error: err.Error() }
+    var validationErr *isfj.ValidationError
+    if errors.As(err, &validationErr) {
+        response.Field = validationErr.Field
+    }
+    writeJSON(w, code, response)
+}
+
+func (s *Server) submit(w http.ResponseWriter, r *http.Request) {
+    var init isfj.JobInit
+    if err := json.NewDecoder(r.Body).Decode(&init); err != nil {
+        var tooLarge *http.MaxBytesError
+        if errors.As(err, &tooLarge) {
+            writeError(w, http.StatusRequestEntityTooLarge, err)
+        } else {
+            writeError(w, http.StatusBadRequest, err)
+        }
+        return
+    }
+    // jobs name a needle, they can't point to arbitrary files
+    needle := init.Needle
+    if needle == "" {
+        needle = "default"
+    }
+    path, ok := s.config.Needles[needle]
+    if !ok && init.Needle != "" {
+        writeError(w, http.StatusBadRequest, &isfj.ValidationError{
+            Field: "Needle",
+            Err: isfj.ErrNeedleNotFound,
+            Detail: init.Needle,
+        })
+        return
+    }
+    init.Needle = path
+    task, err := s.engine.TrySchedule(isfj.NewJob(init))
+    switch {
+        case err == nil:
+        case errors.Is(err, isfj.ErrQueueFull), errors.Is(err, isfj.ErrEngineShutdown): {
+            writeError(w, http.StatusServiceUnavailable, err)
+            return
+        }
+        default: {
+            writeError(w, http.StatusBadRequest, err)
+            return
+        }
+    }
+    s.own(task)
+    s.logger.Info("task submitted", slog.Uint64("task", task.Id()), slog.String("lang", init.Lang))
+    writeJSON(w, http.StatusAccepted, map[string]uint64{ "id": task.Id() })
+}
+
+func (s *Server) lookup(w http.ResponseWriter, r *http.Request) (isfj.TaskView, bool) {
+    id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+    if err != nil {
+        writeError(w, http.StatusBadRequest, fmt.Errorf("invalid task id %q", r.PathValue("id")))
+        return isfj.TaskView{}, false
+    }
+    view, ok := s.engine.GetTask(id)
+    if !ok {
+        writeError(w, http.StatusNotFound, fmt.Errorf("task %d not found", id))
+    }
+    return view, ok
+}
+
+func (s *Server) status(w http.ResponseWriter, r *http.Request) {
+    view, ok := s.lookup(w, r)
+    if !ok {
+        return
+    }
+    writeJSON(w, http.StatusOK, view.SnapJob())
+}
+
+func (s *Server) cancel(w http.ResponseWriter, r *http.Request) {
+    view, ok := s.lookup(w, r)
+    if !ok {
+        return
+    }
+    s.lock.Lock()
+    task, ok := s.tasks[view.Id()]
+    s.lock.Unlock()
+    if !ok {
+        writeError(w, http.StatusConflict, fmt.Errorf("task %d already finished", view.Id()))
+        return
+    }
+    s.engine.CancelTask(task)
+    s.logger.Info("task cancelled", slog.Uint64("task", task.Id()))
+    writeJSON(w, http.StatusOK, task.SnapJob())
+}
+
+// Streams the events of a task as server-sent events.
+// The current job is sent first as a "snapshot" event,
+// and the stream ends after EV_JOB_FINISHED.
+func (s *Server) events(w http.ResponseWriter, r *http.Request) {
+    view, ok := s.lookup(w, r)
+    if !ok {
+        return
+    }
+    flusher, ok := w.(http.Flusher)
+    if !ok {
+        writeError(w, http.StatusInternalServerError, errors.New("streaming unsupported"))
+        return
+    }
+    events := make(chan isfj.Event, 16)
+    sub := view.Subscribe(func(ev isfj.Event) {
+        select {
+            case events <- ev:
+            case <-r.Context().Done():
+        }
+    })
+    defer sub.Unsubscribe()
+    w.Header().Set("Content-Type", "text/event-stream")
+    w.Header().Set("Cache-Control", "no-cache")
+    w.WriteHeader(http.StatusOK)
+    // subscribed first, so nothing after the snapshot is missed
+    job := view.SnapJob()
+    writeEvent(w, "snapshot", job)
+    flusher.Flush()
+    if job.Finished() {
+        return
+    }
+    for {
+        select {
+            case ev := <-events: {
+                writeEvent(w, ev.Kind.Ident(), ev)
+                flusher.Flush()
+                if ev.Kind == isfj.EV_JOB_FINISHED {
+                    return
+                }
+            }
+            case <-r.Context().Done():
+                return
+        }
+    }
+}
+
+func writeEvent(w http.ResponseWriter, name string, value any) {
+    data, _ := json.Marshal(value)
+    fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, data)
+}
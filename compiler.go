@@ -2,10 +2,14 @@ package isfj
 
 import (
     "bytes"
+    "context"
+    "errors"
     "os"
     "os/exec"
     "path"
+    "syscall"
     "text/template"
+    "time"
 
     "github.com/google/shlex"
 )
@@ -18,9 +22,46 @@ Example:
 gcc -o "{{ .Output }}" -x c "{{ .Source }}"
 */
 type Compiler struct {
+    // Parser for the compiler's output.
+    // nil means diagnostics will not be parsed.
+    Diagnostics DiagnosticParser
+    // Maximum bytes of compiler output to keep.
+    // 0 means [DefaultCompilerOutputLimit].
+    OutputLimit int
     command	*template.Template
 }
 
+func splitCommand(command string) ([]string, error) {
+    args, err := shlex.Split(command)
+    if err != nil {
+        return nil, err
+    }
+    if len(args) == 0 {
+        return nil, errors.New("empty command")
+    }
+    return args, nil
+}
+
+// How long to wait for the output of a killed command,
+// in case it was passed to processes outside its group.
+const commandWaitDelay = time.Second
+
+// Like [exec.CommandContext], but kills the whole process group
+// once ctx is done, so that children (e.g. cc1plus, as, ld) holding
+// the output pipes do not delay cancellation.
+func commandContext(ctx context.Context, name string, args ...string) *exec.Cmd {
+    cmd := exec.CommandContext(ctx, name, args...)
+    cmd.SysProcAttr = &syscall.SysProcAttr{ Setpgid: true }
+    cmd.Cancel = func() error {
+        return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+    }
+    cmd.WaitDelay = commandWaitDelay
+    return cmd
+}
+
+// Default value of [Compiler.OutputLimit].
+const DefaultCompilerOutputLimit = 64 * 1024
+
 type compilerTemplateData struct {
     Source	string
     Output	string
@@ -38,14 +79,75 @@ func NewCompiler(templ string) (*Compiler, error) {
     }, nil
 }
 
+func (c *Compiler) diagnose(output, sourceName string) []Diagnostic {
+    if c.Diagnostics == nil {
+        return nil
+    }
+    diagnostics := c.Diagnostics(output)
+    for i := 0; i < len(diagnostics); i++ {
+        if path.Base(diagnostics[i].File) == path.Base(sourceName) {
+            diagnostics[i].File = ""
+        }
+    }
+    return diagnostics
+}
+
+// Output from [Compiler.Compile].
+type CompilerOutput struct {
+    // Status of compilation.
+    Status      Status
+    // Path to the executable.
+    // Only available if Status == [ST_COMPILATION_SUCCESS].
+    Executable  string
+    // Stdout & stderr of the compiler, capped at [Compiler.OutputLimit].
+    // Kept even if compilation succeeds, so warnings can be shown.
+    Log         string
+    // Parsed diagnostics.
+    // Only available if the compiler has a parser.
+    Diagnostics []Diagnostic
+    // Cause of the failure, a [*SystemError].
+    // Only available if Status == [ST_SYSTEM_ERROR].
+    Err         error
+}
+
+type cappedBuffer struct {
+    buf         bytes.Buffer
+    limit       int
+    truncated   bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+    n := len(p)
+    if remaining := b.limit - b.buf.Len(); n > remaining {
+        p = p[:max(remaining, 0)]
+        b.truncated = true
+    }
+    b.buf.Write(p)
+    return n, nil
+}
+
+func (b *cappedBuffer) String() string {
+    if b.truncated {
+        return b.buf.String() + "\n... (output truncated)"
+    }
+    return b.buf.String()
+}
+
 // Compiles given code with this compiler in given temporary folder.
-// If compilation succeeds, will return ([ST_COMPILATION_SUCCESS], executable path).
-// Otherwise, return (status, compiler stdout & stderr).
-func (c *Compiler) Compile(code string, tempDir string) (Status, string) {
+func (c *Compiler) Compile(code string, tempDir string) CompilerOutput {
+    return c.CompileContext(context.Background(), code, tempDir)
+}
+
+// Compiles given code with this compiler in given temporary folder.
+// The compiler is killed once ctx is done, resulting in [ST_CANCELLED].
+func (c *Compiler) CompileContext(ctx context.Context, code string, tempDir string) CompilerOutput {
     sourceName := path.Join(tempDir, randName("src_"))
     err := os.WriteFile(sourceName, []byte(code), 0o666)
     if err != nil {
-        return ST_SYSTEM_ERROR, ""
+        return CompilerOutput{
+            Status: ST_SYSTEM_ERROR,
+            Err: systemError(EC_WRITE_FILE, "write source", err),
+        }
     }
     outputName := path.Join(tempDir, randName("exe_"))
     buf := bytes.Buffer{}
@@ -54,16 +156,49 @@ func (c *Compiler) Compile(code string, tempDir string) (Status, string) {
         Output: outputName,
     })
     if err != nil {
-        return ST_SYSTEM_ERROR, ""
+        return CompilerOutput{
+            Status: ST_SYSTEM_ERROR,
+            Err: systemError(EC_TEMPLATE, "execute compiler template", err),
+        }
+    }
+    args, err := splitCommand(buf.String())
+    if err != nil {
+        return CompilerOutput{
+            Status: ST_SYSTEM_ERROR,
+            Err: systemError(EC_COMMAND, "parse compiler command", err),
+        }
+    }
+    cmd := commandContext(ctx, args[0], args[1:]...)
+    limit := c.OutputLimit
+    if limit <= 0 {
+        limit = DefaultCompilerOutputLimit
+    }
+    output := &cappedBuffer{ limit: limit }
+    cmd.Stdout = output
+    cmd.Stderr = output
+    err = cmd.Run()
+    log := output.String()
+    if ctx.Err() != nil {
+        return CompilerOutput{ Status: ST_CANCELLED, Log: log }
     }
-    args, _ := shlex.Split(buf.String())
-    cmd := exec.Command(args[0], args[1:]...)
-    output, err := cmd.CombinedOutput()
     if err != nil {
         if _, ok := err.(*exec.ExitError); ok {
-            return ST_COMPILATION_ERROR, string(output)
+            return CompilerOutput{
+                Status: ST_COMPILATION_ERROR,
+                Log: log,
+                Diagnostics: c.diagnose(log, sourceName),
+            }
+        }
+        return CompilerOutput{
+            Status: ST_SYSTEM_ERROR,
+            Log: log,
+            Err: systemError(EC_START_PROCESS, "run compiler", err),
         }
-        return ST_SYSTEM_ERROR, ""
     }
-    return ST_COMPILATION_SUCCESS, outputName
-}
\ No newline at end of file
+    return CompilerOutput{
+        Status: ST_COMPILATION_SUCCESS,
+        Executable: outputName,
+        Log: log,
+        Diagnostics: c.diagnose(log, sourceName),
+    }
+}
@@ -0,0 +1,89 @@
+package isfj
+
+import (
+    "context"
+)
+
+// Slots for running programs, shared by all workers.
+// Each slot is either a core, or -1 if not pinned.
+type cpuPool struct {
+    slots   chan int
+}
+
+func newCPUPool(slots []int) *cpuPool {
+    p := &cpuPool{
+        slots: make(chan int, len(slots)),
+    }
+    for _, slot := range slots {
+        p.slots <- slot
+    }
+    return p
+}
+
+// Blocks until a slot is free or ctx is done.
+func (p *cpuPool) acquire(ctx context.Context) (int, error) {
+    select {
+        case slot := <-p.slots:
+            return slot, nil
+        case <-ctx.Done():
+            return 0, ctx.Err()
+    }
+}
+
+func (p *cpuPool) release(slot int) {
+    p.slots <- slot
+}
+
+// Limits the number of programs running at the same time,
+// across all workers and tasks.
+// 0 means unlimited, which is the default.
+// Overrides [Engine.SetCPUCores].
+func (e *Engine) SetCPUSlots(n int) {
+    e.lock.Lock()
+    defer e.lock.Unlock()
+    if n <= 0 {
+        e.cpus = nil
+        return
+    }
+    slots := make([]int, n)
+    for i := range slots {
+        slots[i] = -1
+    }
+    e.cpus = newCPUPool(slots)
+}
+
+// Reserves given cores for running programs, one program per core
+// at a time, across all workers and tasks. Each program and its
+// tracer thread are pinned to the core, reported in [Usages.CPU].
+// Empty means any core, which is the default.
+// Overrides [Engine.SetCPUSlots].
+func (e *Engine) SetCPUCores(cores []int) {
+    e.lock.Lock()
+    defer e.lock.Unlock()
+    if len(cores) == 0 {
+        e.cpus = nil
+        return
+    }
+    e.cpus = newCPUPool(cores)
+}
+
+// Blocks until a program can be run.
+// Returns the cores it should be pinned to (empty if any),
+// and a function releasing the slot.
+func (e *Engine) acquireCPU(ctx context.Context) ([]int, func(), error) {
+    e.lock.Lock()
+    pool := e.cpus
+    e.lock.Unlock()
+    if pool == nil {
+        return nil, func() {}, nil
+    }
+    slot, err := pool.acquire(ctx)
+    if err != nil {
+        return nil, nil, err
+    }
+    release := func() { pool.release(slot) }
+    if slot < 0 {
+        return nil, release, nil
+    }
+    return []int{ slot }, release, nil
+}
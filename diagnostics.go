@@ -0,0 +1,210 @@
+package isfj
+
+import (
+	"bufio"
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Severity of a compiler diagnostic.
+type Severity uint8
+
+// Identifier of the severity.
+func (s Severity) Ident() string {
+    switch s {
+        case SV_ERROR:
+            return "SV_ERROR"
+        case SV_WARNING:
+            return "SV_WARNING"
+        case SV_NOTE:
+            return "SV_NOTE"
+    }
+    panic("All branches already covered.")
+}
+
+// Human-readable string representation.
+func (s Severity) String() string {
+    switch s {
+        case SV_ERROR:
+            return "error"
+        case SV_WARNING:
+            return "warning"
+        case SV_NOTE:
+            return "note"
+    }
+    return "unknown"
+}
+
+const (
+    // Errors prevent the code from compiling.
+    SV_ERROR Severity = iota
+    // Warnings are reported but do not fail compilation.
+    SV_WARNING
+    // Notes and hints attached to other diagnostics.
+    SV_NOTE
+    // Max severity available.
+    SV_MAX = SV_NOTE
+)
+
+func parseSeverity(s string) Severity {
+    switch strings.ToLower(s) {
+        case "warning":
+            return SV_WARNING
+        case "note", "help", "info":
+            return SV_NOTE
+    }
+    return SV_ERROR
+}
+
+// A single message reported by a compiler.
+// Line and Column start from 1. 0 means unknown.
+type Diagnostic struct {
+    // File the diagnostic refers to.
+    // Empty if it refers to the submitted source.
+    File        string      `json:"file" yaml:"file"`
+    Line        int         `json:"line" yaml:"line"`
+    Column      int         `json:"column" yaml:"column"`
+    Severity    Severity    `json:"severity" yaml:"severity"`
+    Message     string      `json:"message" yaml:"message"`
+}
+
+// Parses compiler output into diagnostics.
+type DiagnosticParser func(output string) []Diagnostic
+
+var gccDiagnosticPattern = regexp.MustCompile(
+    `^(.+?):(\d+):(?:(\d+):)?\s*(fatal error|error|warning|note):\s*(.*)$`,
+)
+
+// [DiagnosticParser] for GCC and Clang.
+//
+// Recognizes lines like:
+// main.c:3:5: error: expected ';' before '}' token
+func ParseGCCDiagnostics(output string) []Diagnostic {
+    var diagnostics []Diagnostic
+    scanner := bufio.NewScanner(strings.NewReader(output))
+    for scanner.Scan() {
+        match := gccDiagnosticPattern.FindStringSubmatch(scanner.Text())
+        if match == nil {
+            continue
+        }
+        line, _ := strconv.Atoi(match[2])
+        column, _ := strconv.Atoi(match[3])
+        diagnostics = append(diagnostics, Diagnostic{
+            File: match[1],
+            Line: line,
+            Column: column,
+            Severity: parseSeverity(strings.TrimPrefix(match[4], "fatal ")),
+            Message: match[5],
+        })
+    }
+    return diagnostics
+}
+
+var javacDiagnosticPattern = regexp.MustCompile(`^(.+?\.java):(\d+):\s*(error|warning|note):\s*(.*)$`)
+
+// [DiagnosticParser] for javac.
+//
+// Recognizes lines like:
+// Main.java:3: error: ';' expected
+// The column is taken from the caret line that follows.
+func ParseJavacDiagnostics(output string) []Diagnostic {
+    var diagnostics []Diagnostic
+    scanner := bufio.NewScanner(strings.NewReader(output))
+    for scanner.Scan() {
+        text := scanner.Text()
+        if match := javacDiagnosticPattern.FindStringSubmatch(text); match != nil {
+            line, _ := strconv.Atoi(match[2])
+            diagnostics = append(diagnostics, Diagnostic{
+                File: match[1],
+                Line: line,
+                Severity: parseSeverity(match[3]),
+                Message: match[4],
+            })
+        } else if n := len(diagnostics); n > 0 && diagnostics[n-1].Column == 0 &&
+            strings.TrimSpace(text) == "^" {
+            diagnostics[n-1].Column = strings.Index(text, "^") + 1
+        }
+    }
+    return diagnostics
+}
+
+type rustcSpan struct {
+    FileName    string  `json:"file_name"`
+    LineStart   int     `json:"line_start"`
+    ColumnStart int     `json:"column_start"`
+    IsPrimary   bool    `json:"is_primary"`
+}
+
+type rustcMessage struct {
+    Message     string      `json:"message"`
+    Level       string      `json:"level"`
+    Spans       []rustcSpan `json:"spans"`
+}
+
+// [DiagnosticParser] for rustc invoked with --error-format=json.
+// Lines which are not JSON are ignored.
+func ParseRustcDiagnostics(output string) []Diagnostic {
+    var diagnostics []Diagnostic
+    scanner := bufio.NewScanner(strings.NewReader(output))
+    scanner.Buffer(nil, 1 << 20)
+    for scanner.Scan() {
+        var message rustcMessage
+        if json.Unmarshal(scanner.Bytes(), &message) != nil || message.Level == "failure-note" {
+            continue
+        }
+        diagnostic := Diagnostic{
+            Severity: parseSeverity(message.Level),
+            Message: message.Message,
+        }
+        for _, span := range message.Spans {
+            if span.IsPrimary {
+                diagnostic.File = span.FileName
+                diagnostic.Line = span.LineStart
+                diagnostic.Column = span.ColumnStart
+                break
+            }
+        }
+        diagnostics = append(diagnostics, diagnostic)
+    }
+    return diagnostics
+}
+
+var (
+    pythonFramePattern = regexp.MustCompile(`^\s*File "(.+)", line (\d+)`)
+    pythonErrorPattern = regexp.MustCompile(
+        `^(?:Sorry: )?(\w+(?:Error|Exception|Warning)): (.*?)(?: \((.+), line (\d+)\))?$`,
+    )
+)
+
+// [DiagnosticParser] for Python tracebacks,
+// e.g. those printed by python3 -m py_compile.
+// Each exception is attributed to its innermost frame.
+// Columns are left unknown: Python prints the offending line without
+// its indentation, so the caret doesn't tell the column in the source.
+func ParsePythonDiagnostics(output string) []Diagnostic {
+    var diagnostics []Diagnostic
+    frame := Diagnostic{}
+    scanner := bufio.NewScanner(strings.NewReader(output))
+    for scanner.Scan() {
+        text := scanner.Text()
+        if match := pythonFramePattern.FindStringSubmatch(text); match != nil {
+            line, _ := strconv.Atoi(match[2])
+            frame = Diagnostic{ File: match[1], Line: line }
+        } else if match := pythonErrorPattern.FindStringSubmatch(text); match != nil {
+            diagnostic := frame
+            diagnostic.Message = match[1] + ": " + match[2]
+            if strings.HasSuffix(match[1], "Warning") {
+                diagnostic.Severity = SV_WARNING
+            }
+            if match[3] != "" {
+                diagnostic.File = match[3]
+                diagnostic.Line, _ = strconv.Atoi(match[4])
+            }
+            diagnostics = append(diagnostics, diagnostic)
+            frame = Diagnostic{}
+        }
+    }
+    return diagnostics
+}
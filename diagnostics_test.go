@@ -0,0 +1,88 @@
+package isfj
+
+import (
+    "os"
+    "path/filepath"
+    "reflect"
+    "testing"
+)
+
+// Compiler output in testdata/diagnostics. Captured from gcc 12,
+// rustc 1.90 and Python 3.11; the clang and javac samples follow
+// the output of clang 14 and javac 17.
+func TestDiagnosticParsers(t *testing.T) {
+    tests := []struct {
+        file        string
+        parser      DiagnosticParser
+        expected    []Diagnostic
+    }{
+        {
+            "gcc.txt", ParseGCCDiagnostics, []Diagnostic{
+                { File: "main.c", Line: 4, Column: 20, Severity: SV_ERROR, Message: "'y' undeclared (first use in this function)" },
+                { File: "main.c", Line: 4, Column: 20, Severity: SV_NOTE, Message: "each undeclared identifier is reported only once for each function it appears in" },
+                { File: "main.c", Line: 4, Column: 22, Severity: SV_ERROR, Message: "expected ';' before '}' token" },
+                { File: "main.c", Line: 3, Column: 9, Severity: SV_WARNING, Message: "unused variable 'x' [-Wunused-variable]" },
+            },
+        },
+        {
+            "gcc-fatal.txt", ParseGCCDiagnostics, []Diagnostic{
+                { File: "f.c", Line: 1, Column: 10, Severity: SV_ERROR, Message: "missing.h: No such file or directory" },
+            },
+        },
+        {
+            "clang.txt", ParseGCCDiagnostics, []Diagnostic{
+                { File: "main.c", Line: 4, Column: 20, Severity: SV_ERROR, Message: "use of undeclared identifier 'y'" },
+                { File: "main.c", Line: 4, Column: 22, Severity: SV_ERROR, Message: "expected ';' after expression" },
+                { File: "main.c", Line: 3, Column: 9, Severity: SV_WARNING, Message: "unused variable 'x' [-Wunused-variable]" },
+            },
+        },
+        {
+            "javac.txt", ParseJavacDiagnostics, []Diagnostic{
+                { File: "Main.java", Line: 3, Column: 21, Severity: SV_WARNING, Message: "[removal] Integer(int) in Integer has been deprecated and marked for removal" },
+                { File: "Main.java", Line: 4, Column: 28, Severity: SV_ERROR, Message: "cannot find symbol" },
+            },
+        },
+        {
+            "javac-syntax.txt", ParseJavacDiagnostics, []Diagnostic{
+                { File: "Main.java", Line: 3, Column: 18, Severity: SV_ERROR, Message: "';' expected" },
+            },
+        },
+        {
+            "rustc.json", ParseRustcDiagnostics, []Diagnostic{
+                { File: "main.rs", Line: 3, Column: 18, Severity: SV_ERROR, Message: "mismatched types" },
+                { Severity: SV_ERROR, Message: "aborting due to 1 previous error" },
+            },
+        },
+        {
+            "rustc-warning.json", ParseRustcDiagnostics, []Diagnostic{
+                { File: "w.rs", Line: 2, Column: 9, Severity: SV_WARNING, Message: "unused variable: `x`" },
+                { Severity: SV_WARNING, Message: "1 warning emitted" },
+            },
+        },
+        {
+            "python.txt", ParsePythonDiagnostics, []Diagnostic{
+                { File: "c.py", Line: 1, Message: "SyntaxError: invalid syntax" },
+            },
+        },
+        {
+            // the caret is under the line printed without its indentation
+            "python-indented.txt", ParsePythonDiagnostics, []Diagnostic{
+                { File: "b.py", Line: 2, Message: "SyntaxError: invalid syntax" },
+            },
+        },
+        {
+            "python-indentation.txt", ParsePythonDiagnostics, []Diagnostic{
+                { File: "d.py", Line: 3, Message: "IndentationError: unindent does not match any outer indentation level" },
+            },
+        },
+    }
+    for _, test := range tests {
+        output, err := os.ReadFile(filepath.Join("testdata", "diagnostics", test.file))
+        if err != nil {
+            t.Fatal(err)
+        }
+        if diagnostics := test.parser(string(output)); !reflect.DeepEqual(diagnostics, test.expected) {
+            t.Errorf("%s: expected %+v, got %+v", test.file, test.expected, diagnostics)
+        }
+    }
+}
@@ -0,0 +1,183 @@
+package isfj
+
+import (
+    "encoding/json"
+    "fmt"
+)
+
+// Parses a status from its identifier, e.g. "ST_ACCEPTED".
+func ParseStatus(ident string) (Status, error) {
+    for s := Status(0); s <= ST_MAX; s++ {
+        if s.Ident() == ident {
+            return s, nil
+        }
+    }
+    return 0, fmt.Errorf("unknown status %q", ident)
+}
+
+// Encodes the status as its identifier.
+func (s Status) MarshalText() ([]byte, error) {
+    if s > ST_MAX {
+        return nil, fmt.Errorf("invalid status %d", s)
+    }
+    return []byte(s.Ident()), nil
+}
+
+// Decodes a status from its identifier.
+func (s *Status) UnmarshalText(text []byte) error {
+    status, err := ParseStatus(string(text))
+    if err != nil {
+        return err
+    }
+    *s = status
+    return nil
+}
+
+// Encodes the status as its identifier, e.g. "ST_ACCEPTED".
+func (s Status) MarshalJSON() ([]byte, error) {
+    text, err := s.MarshalText()
+    if err != nil {
+        return nil, err
+    }
+    return json.Marshal(string(text))
+}
+
+// Decodes a status from its identifier.
+// Numbers are accepted as well, as written by older versions.
+func (s *Status) UnmarshalJSON(data []byte) error {
+    var number uint16
+    if json.Unmarshal(data, &number) == nil {
+        if Status(number) > ST_MAX {
+            return fmt.Errorf("invalid status %d", number)
+        }
+        *s = Status(number)
+        return nil
+    }
+    var ident string
+    if err := json.Unmarshal(data, &ident); err != nil {
+        return err
+    }
+    return s.UnmarshalText([]byte(ident))
+}
+
+// Encodes the severity as its identifier, e.g. "SV_ERROR".
+func (s Severity) MarshalText() ([]byte, error) {
+    if s > SV_MAX {
+        return nil, fmt.Errorf("invalid severity %d", s)
+    }
+    return []byte(s.Ident()), nil
+}
+
+// Decodes a severity from its identifier.
+func (s *Severity) UnmarshalText(text []byte) error {
+    for v := Severity(0); v <= SV_MAX; v++ {
+        if v.Ident() == string(text) {
+            *s = v
+            return nil
+        }
+    }
+    return fmt.Errorf("unknown severity %q", text)
+}
+
+// Structured form of a [JudgeMode], e.g.
+// {"mode": "J_SPECIAL", "judger": 1}.
+type judgeModeObject struct {
+    Mode    string  `json:"mode" yaml:"mode"`
+    // Only available if Mode == "J_SPECIAL".
+    Judger  *int    `json:"judger,omitempty" yaml:"judger,omitempty"`
+}
+
+func (m JudgeMode) object() (judgeModeObject, error) {
+    if m.ModeBits() > J_SPECIAL {
+        return judgeModeObject{}, fmt.Errorf("invalid judge mode %d", m)
+    }
+    o := judgeModeObject{ Mode: m.Ident() }
+    if m.ModeBits() == J_SPECIAL {
+        judger := m.JudgerId()
+        o.Judger = &judger
+    }
+    return o, nil
+}
+
+func (o judgeModeObject) judgeMode() (JudgeMode, error) {
+    for m := J_LAX; m <= J_SPECIAL; m++ {
+        if m.Ident() != o.Mode {
+            continue
+        }
+        if m != J_SPECIAL {
+            if o.Judger != nil {
+                return 0, fmt.Errorf("judger given for %s", o.Mode)
+            }
+            return m, nil
+        }
+        if o.Judger == nil {
+            return 0, fmt.Errorf("no judger given for %s", o.Mode)
+        }
+        if *o.Judger < 0 || *o.Judger > 0xff {
+            return 0, fmt.Errorf("judger id %d out of range", *o.Judger)
+        }
+        return MakeSpecialJudgeMode(*o.Judger), nil
+    }
+    return 0, fmt.Errorf("unknown judge mode %q", o.Mode)
+}
+
+// Encodes the mode as an object with the mode identifier
+// and the judger id, e.g. {"mode": "J_SPECIAL", "judger": 1}.
+func (m JudgeMode) MarshalJSON() ([]byte, error) {
+    o, err := m.object()
+    if err != nil {
+        return nil, err
+    }
+    return json.Marshal(o)
+}
+
+// Decodes a mode as written by older versions.
+func (m *JudgeMode) setNumber(number uint16) error {
+    if JudgeMode(number).ModeBits() > J_SPECIAL {
+        return fmt.Errorf("invalid judge mode %d", number)
+    }
+    *m = JudgeMode(number)
+    return nil
+}
+
+// Decodes a mode from an object, see [JudgeMode.MarshalJSON].
+// Numbers are accepted as well, as written by older versions.
+func (m *JudgeMode) UnmarshalJSON(data []byte) error {
+    var number uint16
+    if json.Unmarshal(data, &number) == nil {
+        return m.setNumber(number)
+    }
+    var o judgeModeObject
+    if err := json.Unmarshal(data, &o); err != nil {
+        return err
+    }
+    mode, err := o.judgeMode()
+    if err != nil {
+        return err
+    }
+    *m = mode
+    return nil
+}
+
+// Encodes the mode in YAML, see [JudgeMode.MarshalJSON].
+func (m JudgeMode) MarshalYAML() (any, error) {
+    return m.object()
+}
+
+// Decodes a mode from YAML, see [JudgeMode.MarshalJSON].
+func (m *JudgeMode) UnmarshalYAML(unmarshal func(any) error) error {
+    var number uint16
+    if unmarshal(&number) == nil {
+        return m.setNumber(number)
+    }
+    var o judgeModeObject
+    if err := unmarshal(&o); err != nil {
+        return err
+    }
+    mode, err := o.judgeMode()
+    if err != nil {
+        return err
+    }
+    *m = mode
+    return nil
+}
@@ -0,0 +1,170 @@
+package isfj
+
+import (
+    "encoding/json"
+    "reflect"
+    "strings"
+    "testing"
+    "time"
+
+    "gopkg.in/yaml.v3"
+)
+
+func roundTripJSON[T any](t *testing.T, value T) {
+    t.Helper()
+    data, err := json.Marshal(value)
+    if err != nil {
+        t.Fatalf("marshal %v: %v", value, err)
+    }
+    var decoded T
+    if err := json.Unmarshal(data, &decoded); err != nil {
+        t.Fatalf("unmarshal %s: %v", data, err)
+    }
+    if !reflect.DeepEqual(decoded, value) {
+        t.Errorf("JSON round trip of %+v gave %+v", value, decoded)
+    }
+}
+
+func roundTripYAML[T any](t *testing.T, value T) {
+    t.Helper()
+    data, err := yaml.Marshal(value)
+    if err != nil {
+        t.Fatalf("marshal %v: %v", value, err)
+    }
+    var decoded T
+    if err := yaml.Unmarshal(data, &decoded); err != nil {
+        t.Fatalf("unmarshal %s: %v", data, err)
+    }
+    if !reflect.DeepEqual(decoded, value) {
+        t.Errorf("YAML round trip of %+v gave %+v", value, decoded)
+    }
+}
+
+func testCase() Case {
+    return Case{
+        Stdin: "1 2\n",
+        Stdout: "3\n",
+        Args: []string{ "-v" },
+        Limits: Limits{ Time: 1000000, StackMemory: 8 << 20, HeapMemory: 256 << 20, Memory: 264 << 20 },
+        Points: 10,
+    }
+}
+
+func testEncodedJob() Job {
+    return Job{
+        Code: "int main() {}",
+        Lang: "c",
+        Needle: "/etc/isfj/needle.so",
+        Status: ST_SYSTEM_ERROR,
+        Mode: MakeSpecialJudgeMode(3),
+        Cases: []Case{ testCase(), testCase() },
+        Groups: [][]int{ { 1 }, { 2 } },
+        SkipGroups: true,
+        Results: []CaseResult{
+            {
+                Status: ST_COMPILATION_SUCCESS,
+                Usages: Usages{ CPU: -1 },
+                Extra: "main.c:1:1: warning: unused",
+                Diagnostics: []Diagnostic{
+                    { Line: 1, Column: 1, Severity: SV_WARNING, Message: "unused" },
+                    { File: "lib.h", Line: 2, Severity: SV_NOTE, Message: "declared here" },
+                },
+            },
+            {
+                Status: ST_ACCEPTED,
+                Usages: Usages{ Time: 1500, Memory: 4096, CPU: 2 },
+                Points: 10,
+            },
+            {
+                Status: ST_SYSTEM_ERROR,
+                Usages: Usages{ CPU: -1 },
+                Extra: "run judger: boom",
+                Error: "run judger: boom",
+                ErrorCode: EC_START_PROCESS,
+            },
+        },
+        Updated: time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC),
+        Priority: 1,
+        Queue: "live",
+        Restarts: 2,
+    }
+}
+
+func TestStatusRoundTrip(t *testing.T) {
+    for s := Status(0); s <= ST_MAX; s++ {
+        roundTripJSON(t, s)
+        roundTripYAML(t, s)
+        data, _ := json.Marshal(s)
+        if string(data) != `"` + s.Ident() + `"` {
+            t.Errorf("%s encoded as %s", s.Ident(), data)
+        }
+    }
+}
+
+func TestJudgeModeRoundTrip(t *testing.T) {
+    modes := []JudgeMode{ J_LAX, J_STRICT, MakeSpecialJudgeMode(0), MakeSpecialJudgeMode(255) }
+    for _, m := range modes {
+        roundTripJSON(t, m)
+        roundTripYAML(t, m)
+    }
+}
+
+func TestCaseRoundTrip(t *testing.T) {
+    roundTripJSON(t, testCase())
+    roundTripYAML(t, testCase())
+}
+
+func TestJobRoundTrip(t *testing.T) {
+    roundTripJSON(t, testEncodedJob())
+    roundTripYAML(t, testEncodedJob())
+}
+
+func TestDiagnosticEncodedByName(t *testing.T) {
+    data, err := json.Marshal(Diagnostic{ Line: 3, Severity: SV_NOTE, Message: "here" })
+    if err != nil {
+        t.Fatal(err)
+    }
+    expected := `{"file":"","line":3,"column":0,"severity":"SV_NOTE","message":"here"}`
+    if string(data) != expected {
+        t.Errorf("expected %s, got %s", expected, data)
+    }
+    var d Diagnostic
+    if err := json.Unmarshal([]byte(`{"severity":"SV_FATAL"}`), &d); err == nil {
+        t.Error("unknown severity accepted")
+    }
+}
+
+func TestLegacyNumbers(t *testing.T) {
+    var s Status
+    if err := json.Unmarshal([]byte("3"), &s); err != nil || s != ST_ACCEPTED {
+        t.Errorf("numeric status decoded as %v, %v", s, err)
+    }
+    var m JudgeMode
+    if err := json.Unmarshal([]byte("258"), &m); err != nil || m != MakeSpecialJudgeMode(1) {
+        t.Errorf("numeric mode decoded as %v, %v", m, err)
+    }
+    if err := yaml.Unmarshal([]byte("1"), &m); err != nil || m != J_STRICT {
+        t.Errorf("numeric mode decoded as %v, %v", m, err)
+    }
+}
+
+func TestInvalidNumbersRejected(t *testing.T) {
+    for _, data := range []string{ "7", "259", "1023" } {
+        var m JudgeMode
+        if err := json.Unmarshal([]byte(data), &m); err == nil {
+            t.Errorf("JSON judge mode %s accepted", data)
+        }
+        if err := yaml.Unmarshal([]byte(data), &m); err == nil {
+            t.Errorf("YAML judge mode %s accepted", data)
+        }
+    }
+    var s Status
+    if err := json.Unmarshal([]byte("999"), &s); err == nil {
+        t.Error("JSON status 999 accepted")
+    }
+    var job Job
+    err := json.Unmarshal([]byte(`{"mode": 7}`), &job)
+    if err == nil || !strings.Contains(err.Error(), "invalid judge mode") {
+        t.Errorf("job with judge mode 7 decoded with %v", err)
+    }
+}
@@ -1,9 +1,12 @@
 package isfj
 
 import (
+    "context"
     "fmt"
+    "log/slog"
     "os"
     "path"
+    "runtime/debug"
     "slices"
     "sync"
     "time"
@@ -16,9 +19,26 @@ type Engine struct {
     judgers			[]SpecialJudger
     compilers		map[string]*Compiler
     counter			uint64
-    queue			chan *Task
-    stopFlag		chan any
-    taskIds			[]uint64
+    queue			taskQueue
+    capacity		int
+    changed			chan any
+    cpus			*cpuPool
+    running			map[uint64]*Task
+    stopping		bool
+    workers			[]*worker
+    workerCounter	int
+    alive			sync.WaitGroup
+    errorHandler	func(uint64, error)
+    events			broadcaster
+    store			TaskStore
+    logger			*slog.Logger
+    tracer			Tracer
+    metrics			Metrics
+    tasks			map[uint64]*Task
+    finished		[]finishedTask
+    retention		RetentionPolicy
+    // Whether finished tasks are kept, see [Engine.SetRetention].
+    retain			bool
     lock			sync.Mutex
 }
 
@@ -29,8 +49,13 @@ func NewEngine(tempDirBase string) *Engine {
         TempDirBase: tempDirBase,
         counter: 0,
         compilers: map[string]*Compiler{},
-        queue: make(chan *Task),
-        stopFlag: make(chan any),
+        queue: taskQueue{
+            limits: map[string]int{},
+            running: map[string]int{},
+        },
+        changed: make(chan any),
+        running: map[uint64]*Task{},
+        tasks: map[uint64]*Task{},
     }
 }
 
@@ -48,55 +73,188 @@ func (e *Engine) AddJudger(judger SpecialJudger) int {
     return id
 }
 
-// Create a task associated to given job,
-// and send the task to workers.
-func (e *Engine) Schedule(job Job) *Task {
-    e.lock.Lock()
-    defer e.lock.Unlock()
+// Checks whether given job can be executed by this engine.
+// Returns a [*ValidationError] if not.
+func (e *Engine) Validate(job Job) error {
+    if err := job.Validate(); err != nil {
+        return err
+    }
+    if _, ok := e.compilers[job.Lang]; !ok {
+        return &ValidationError{ Field: "Lang", Err: ErrUnknownLanguage, Detail: job.Lang }
+    }
+    if job.Mode.ModeBits() == J_SPECIAL && job.Mode.JudgerId() >= len(e.judgers) {
+        return &ValidationError{
+            Field: "Mode",
+            Err: ErrUnknownJudger,
+            Detail: fmt.Sprintf("judger id %d", job.Mode.JudgerId()),
+        }
+    }
+    return nil
+}
+
+// Must be called with e.lock held.
+func (e *Engine) newTask(id uint64, job Job) *Task {
+    ctx, stop := context.WithCancel(context.Background())
     t := &Task{
-        id: e.counter,
+        id: id,
         lock: sync.Mutex{},
-        job: job,
+        job: job.Clone(),
         tempDir: path.Join(e.TempDirBase, randName("job_")),
+        ctx: ctx,
+        stop: stop,
+        engine: e,
+        done: make(chan any),
+        version: 1,
     }
-    e.counter++
-    e.taskIds = append(e.taskIds, t.id)
-    e.queue <- t
+    var tracer Tracer = noopTracer{}
+    if e.tracer != nil {
+        tracer = e.tracer
+    }
+    t.trace, t.span = tracer.Start(context.Background(), "isfj.task",
+        slog.Uint64("task", id),
+        slog.String("lang", job.Lang),
+        slog.String("queue", job.Queue),
+        slog.Int("priority", job.Priority),
+        slog.Int("restarts", job.Restarts),
+    )
+    _, t.queueSpan = tracer.Start(t.trace, "isfj.queue")
+    e.tasks[id] = t
     return t
 }
 
-// Check whether given task is running.
+// Create a task associated to given job,
+// and send the task to workers.
+// Blocks while the queue is full, see [Engine.SetQueueCapacity].
+// Invalid jobs are rejected, see [Engine.Validate].
+func (e *Engine) Schedule(job Job) (*Task, error) {
+    return e.enqueue(context.Background(), job, true)
+}
+
+// Same as [Engine.Schedule], but gives up
+// when ctx is done while the queue is full.
+func (e *Engine) ScheduleContext(ctx context.Context, job Job) (*Task, error) {
+    return e.enqueue(ctx, job, true)
+}
+
+// Same as [Engine.Schedule], but returns
+// [ErrQueueFull] instead of blocking.
+func (e *Engine) TrySchedule(job Job) (*Task, error) {
+    return e.enqueue(context.Background(), job, false)
+}
+
+// Check whether given task is waiting for a worker.
 func (e *Engine) ContainsTask(id uint64) bool {
     e.lock.Lock()
     defer e.lock.Unlock()
-    return slices.Contains(e.taskIds, id)
+    return e.queue.contains(id)
 }
 
 func (e *Engine) removeTask(id uint64) bool {
     e.lock.Lock()
     defer e.lock.Unlock()
-    index := slices.Index(e.taskIds, id)
-    if index >= 0 {
-        e.taskIds = slices.Delete(e.taskIds, index, index+1)
+    if e.queue.remove(id) {
+        e.notify()
+        return true
     }
-    return index >= 0
+    return false
 }
 
-// Cancels given task.
+// Cancels given task, whether it is scheduled or running.
+// Running compilers, programs and special judgers are killed.
 // Passing a pointer ensures that only
 // those owning the task can cancel it.
 func (e *Engine) CancelTask(task *Task) {
-    if e.removeTask(task.id) {
-        task.cancel()
-    }       
+    e.removeTask(task.id)
+    task.cancel()
+}
+
+// Sets a handler called every time a worker
+// encounters an internal failure, e.g. a panic or a [*SystemError].
+// The handler receives the id of the affected task.
+func (e *Engine) OnInternalError(handler func(id uint64, err error)) {
+    e.lock.Lock()
+    defer e.lock.Unlock()
+    e.errorHandler = handler
+}
+
+func (e *Engine) reportError(id uint64, err error) {
+    e.lock.Lock()
+    handler := e.errorHandler
+    metrics := e.metrics
+    e.lock.Unlock()
+    if metrics != nil {
+        metrics.SystemError(errorCode(err))
+    }
+    e.getLogger().Error("internal failure", slog.Uint64("task", id), errorAttr(err))
+    if handler != nil {
+        handler(id, err)
+    }
 }
 
 type worker struct {
+    id		int
     judgers	[]SpecialJudger
     engine 	*Engine
+    // Guarded by engine.lock.
+    retired	bool
+    lock	sync.Mutex
+    state	WorkerState
+    task	uint64
+    cases	[]int
+}
+
+func (w *worker) judge(task *Task, i int, got string) (Status, error) {
+    expected := task.job.Cases[i].Stdout
+    switch task.job.Mode.ModeBits() {
+        case J_LAX: {
+            if LaxJudge(got, expected) {
+                return ST_ACCEPTED, nil
+            }
+            return ST_WRONG_ANSWER, nil
+        }
+        case J_STRICT: {
+            if StrictJudge(got, expected) {
+                return ST_ACCEPTED, nil
+            }
+            return ST_WRONG_ANSWER, nil
+        }
+    }
+    judger, err := w.judgers[task.job.Mode.JudgerId()].Clone()
+    if err != nil {
+        return ST_SYSTEM_ERROR, systemError(EC_JUDGER, "clone judger", err)
+    }
+    defer judger.Dispose()
+    start := time.Now()
+    var status Status
+    if judger, ok := judger.(InputJudger); ok {
+        status, err = judger.JudgeInput(task.ctx, task.job.Cases[i].Stdin, got, expected, task.tempDir)
+    } else {
+        status, err = judger.Judge(task.ctx, got, expected, task.tempDir)
+    }
+    if err == nil && status > ST_MAX {
+        err = systemError(EC_JUDGER, "judge", fmt.Errorf("invalid status %d", status))
+        status = ST_SYSTEM_ERROR
+    }
+    if metrics := w.engine.getMetrics(); metrics != nil {
+        metrics.JudgeFinished(task.job.Mode.JudgerId(), status, time.Since(start))
+    }
+    w.logger(task).Debug("judger finished",
+        slog.Int("case", i+1),
+        slog.Int("judger", task.job.Mode.JudgerId()),
+        slog.String("status", status.Ident()),
+        durationAttr(start),
+        errorAttr(err),
+    )
+    return status, err
 }
 
-func (w *worker) runOne(task *Task, executable string, i int) {
+// Judges a case, returning its status.
+func (w *worker) runOne(task *Task, executable string, i int) Status {
+    if task.ctx.Err() != nil {
+        return ST_CANCELLED
+    }
+    trace, span := w.engine.startSpan(task.trace, "isfj.case", slog.Int("case", i+1))
+    defer span.End()
     input := RunnerInput{
         Executable: executable,
         Arguments: task.job.Cases[i].Args,
@@ -104,58 +262,108 @@ func (w *worker) runOne(task *Task, executable string, i int) {
         Stdin: task.job.Cases[i].Stdin,
         Limits: task.job.Cases[i].Limits,
     }
-    task.update(func() {
+    cpus, release, err := w.engine.acquireCPU(task.ctx)
+    if err != nil {
+        return ST_CANCELLED
+    }
+    input.CPUs = cpus
+    w.startCase(i+1)
+    defer w.finishCase(i+1)
+    task.update(EV_CASE_STARTED, i+1, func() {
         task.job.Results[i+1].Status = ST_RUNNING
     })
-    output := Run(input)
-    task.update(func() {
-        if output.Status != ST_ACCEPTED {
-            task.job.Results[i+1].Status = output.Status
-        }
-        task.job.Results[i+1].Usages = output.Usages
+    start := time.Now()
+    _, runSpan := w.engine.startSpan(trace, "isfj.run", slog.Int("case", i+1))
+    // Released before judging, and even if the runner panics.
+    output := func() RunnerOutput {
+        defer release()
+        return RunContext(task.ctx, input)
+    }()
+    runSpan.SetAttributes(
+        slog.String("status", output.Status.Ident()),
+        slog.Uint64("time", output.Usages.Time),
+        slog.Uint64("memory", output.Usages.Memory),
+    )
+    runSpan.RecordError(output.Err)
+    runSpan.End()
+    w.logger(task).Debug("program finished",
+        slog.Int("case", i+1),
+        slog.String("status", output.Status.Ident()),
+        slog.Uint64("time", output.Usages.Time),
+        slog.Uint64("memory", output.Usages.Memory),
+        slog.Int("cpu", output.Usages.CPU),
+        durationAttr(start),
+        errorAttr(output.Err),
+    )
+    status, err := output.Status, output.Err
+    if status == ST_ACCEPTED {
+        _, judgeSpan := w.engine.startSpan(trace, "isfj.judge", slog.Int("case", i+1))
+        status, err = w.judge(task, i, output.Stdout)
+        judgeSpan.SetAttributes(slog.String("status", status.Ident()))
+        judgeSpan.RecordError(err)
+        judgeSpan.End()
+    }
+    if err != nil {
+        w.engine.reportError(task.id, err)
+    }
+    if metrics := w.engine.getMetrics(); metrics != nil {
+        metrics.CaseFinished(task.job.Lang, status, output.Usages)
+    }
+    span.SetAttributes(slog.String("status", status.Ident()))
+    span.RecordError(err)
+    w.logger(task).Debug("case finished",
+        slog.Int("case", i+1),
+        slog.String("status", status.Ident()),
+        durationAttr(start),
+        errorAttr(err),
+    )
+    task.update(EV_CASE_FINISHED, i+1, func() {
+        result := &task.job.Results[i+1]
+        result.Status = status
+        result.Usages = output.Usages
         switch output.Status {
             case ST_RUNTIME_ERROR: {
-                task.job.Results[i+1].Extra = fmt.Sprintf("Process terminated by signal %d", output.ExitInfo)
+                result.Extra = fmt.Sprintf("Process terminated by signal %d", output.ExitInfo)
             }
             case ST_HOSTILE_CODE: {
-                task.job.Results[i+1].Extra = 
-                    fmt.Sprintf("Process killed due to malicious syscall %d", output.ExitInfo)
+                result.Extra = fmt.Sprintf("Process killed due to malicious syscall %d", output.ExitInfo)
             }
         }
+        if err != nil {
+            result.fail(err)
+        }
+        if status == ST_ACCEPTED {
+            result.Points = max(task.job.Cases[i].Points - output.Deduction, 0)
+        }
     })
-    if output.Status == ST_ACCEPTED {
-        var status Status
-        switch task.job.Mode.ModeBits() {
-            case J_LAX: {
-                if LaxJudge(output.Stdout, task.job.Cases[i].Stdout) {
-                    status = ST_ACCEPTED
-                } else {
-                    status = ST_WRONG_ANSWER
-                }
-            }
-            case J_STRICT: {
-                if StrictJudge(output.Stdout, task.job.Cases[i].Stdout) {
-                    status = ST_ACCEPTED
-                } else {
-                    status = ST_WRONG_ANSWER
-                }
-            }
-            case J_SPECIAL: {
-                judger, err := w.judgers[task.job.Mode.JudgerId()].Clone()
-                if err != nil {
-                    status = ST_SYSTEM_ERROR
-                } else {
-                    status = judger.Judge(output.Stdout, task.job.Cases[i].Stdout, task.tempDir)
-                }
-            }
+    return status
+}
+
+// Calls f, recovering from any panic inside.
+// Recovered panics are reported to the engine.
+func (w *worker) protect(task *Task, f func()) (err *PanicError) {
+    defer func() {
+        if value := recover(); value != nil {
+            err = &PanicError{ Value: value, Stack: debug.Stack() }
+            w.engine.reportError(task.id, err)
         }
-        task.update(func() {
-            task.job.Results[i+1].Status = status
-            if status == ST_ACCEPTED {
-                task.job.Results[i+1].Points = max(task.job.Cases[i].Points - output.Deduction, 0)
-            }
+    }()
+    f()
+    return nil
+}
+
+func (w *worker) runProtected(task *Task, executable string, i int) Status {
+    var status Status
+    err := w.protect(task, func() {
+        status = w.runOne(task, executable, i)
+    })
+    if err != nil {
+        task.update(EV_CASE_FINISHED, i+1, func() {
+            task.job.Results[i+1].fail(systemError(EC_PANIC, "judge case", err))
         })
+        return ST_SYSTEM_ERROR
     }
+    return status
 }
 
 func (w *worker) runUnpacked(task *Task, executable string) {
@@ -164,7 +372,7 @@ func (w *worker) runUnpacked(task *Task, executable string) {
     for i := 0; i < len(task.job.Cases); i++ {
         go func(){
             defer wg.Done()
-            w.runOne(task, executable, i)
+            w.runProtected(task, executable, i)
         }()
     }
     wg.Wait()
@@ -176,8 +384,20 @@ func (w *worker) runPacked(task *Task, executable string) {
     for _, group := range task.job.Groups {
         go func(){
             defer wg.Done()
-            for _, i := range group {
-                w.runOne(task, executable, i-1)
+            for j, i := range group {
+                status := w.runProtected(task, executable, i-1)
+                if status == ST_ACCEPTED || !task.job.SkipGroups {
+                    continue
+                }
+                // The group has failed, the rest of it is skipped.
+                if task.ctx.Err() == nil {
+                    for _, k := range group[j+1:] {
+                        task.update(EV_CASE_FINISHED, k, func() {
+                            task.job.Results[k].Status = ST_SKIPPED
+                        })
+                    }
+                }
+                break
             }
         }()
     }
@@ -185,35 +405,66 @@ func (w *worker) runPacked(task *Task, executable string) {
 }
 
 func (w *worker) run(task *Task) {
-    task.update(func() {
+    w.setState(WS_COMPILING, task.id)
+    w.logger(task).Info("job started", slog.Int("cases", len(task.job.Cases)))
+    task.update(EV_JOB_STARTED, -1, func() {
         task.job.Status = ST_RUNNING
     })
-    os.MkdirAll(task.tempDir, 0o777)
     defer os.RemoveAll(task.tempDir)
-    compiler := w.engine.compilers[task.job.Lang]
-    status, output := compiler.Compile(task.job.Code, task.tempDir)
-    task.update(func() {
-        task.job.Results[0].Status = status
+    var output CompilerOutput
+    if err := os.MkdirAll(task.tempDir, 0o777); err != nil {
+        output = CompilerOutput{
+            Status: ST_SYSTEM_ERROR,
+            Err: systemError(EC_MKDIR, "create temporary folder", err),
+        }
+    } else {
+        compiler := w.engine.compilers[task.job.Lang]
+        start := time.Now()
+        _, span := w.engine.startSpan(task.trace, "isfj.compile")
+        output = compiler.CompileContext(task.ctx, task.job.Code, task.tempDir)
+        span.SetAttributes(slog.String("status", output.Status.Ident()))
+        span.RecordError(output.Err)
+        span.End()
+        if metrics := w.engine.getMetrics(); metrics != nil {
+            metrics.CompileFinished(task.job.Lang, output.Status, time.Since(start))
+        }
+        w.logger(task).Debug("compilation finished",
+            slog.Int("case", 0),
+            slog.String("status", output.Status.Ident()),
+            durationAttr(start),
+            errorAttr(output.Err),
+        )
+    }
+    if output.Err != nil {
+        w.engine.reportError(task.id, output.Err)
+    }
+    task.update(EV_COMPILE_FINISHED, 0, func() {
+        task.job.Results[0].Status = output.Status
+        task.job.Results[0].Extra = output.Log
+        task.job.Results[0].Diagnostics = output.Diagnostics
+        if output.Err != nil {
+            task.job.Results[0].fail(output.Err)
+        }
     })
-    if status != ST_COMPILATION_SUCCESS {
-        task.update(func() {
-            task.job.Results[0].Extra = output
-            task.job.Status = status
-            for i := 0; i < len(task.job.Results); i++ {
+    if output.Status != ST_COMPILATION_SUCCESS {
+        task.update(EV_JOB_FINISHED, -1, func() {
+            task.job.Status = output.Status
+            for i := 1; i < len(task.job.Results); i++ {
                 task.job.Results[i].Status = ST_SKIPPED
             }
         })
         return
     }
+    w.setState(WS_RUNNING, task.id)
     if task.job.Groups != nil {
-        w.runPacked(task, output)	
+        w.runPacked(task, output.Executable)
     } else {
-        w.runUnpacked(task, output)
+        w.runUnpacked(task, output.Executable)
     }
-    task.update(func() {
+    task.update(EV_JOB_FINISHED, -1, func() {
         broke := false
         for _, result := range task.job.Results[1:] {
-            if result.Status != ST_ACCEPTED {
+            if result.Status != ST_ACCEPTED && result.Status != ST_SKIPPED {
                 task.job.Status = result.Status
                 broke = true
                 break
@@ -225,35 +476,69 @@ func (w *worker) run(task *Task) {
     })
 }
 
-func (w *worker) poll() {
-    for {
-        select {
-            case task := <-w.engine.queue: {
-                if w.engine.ContainsTask(task.id) {
-                    w.engine.removeTask(task.id)
-                    w.run(task)
+func (w *worker) runTask(task *Task) {
+    defer task.stop()
+    start := time.Now()
+    defer func() {
+        status := task.status()
+        if metrics := w.engine.getMetrics(); metrics != nil {
+            metrics.JobFinished(task.job.Lang, status, time.Since(start))
+        }
+        w.logger(task).Info("job finished",
+            slog.String("status", status.Ident()),
+            durationAttr(start),
+        )
+    }()
+    err := w.protect(task, func() {
+        w.run(task)
+    })
+    if err != nil {
+        task.update(EV_JOB_FINISHED, -1, func() {
+            task.job.Status = ST_SYSTEM_ERROR
+            for i := 0; i < len(task.job.Results); i++ {
+                if status := task.job.Results[i].Status; status == ST_WAITING || status == ST_RUNNING {
+                    task.job.Results[i].fail(systemError(EC_PANIC, "run task", err))
                 }
             }
-            case <-w.engine.stopFlag: {
-                return
-            }
+        })
+    }
+}
+
+func (w *worker) poll() {
+    defer w.engine.alive.Done()
+    defer w.engine.removeWorker(w)
+    defer w.dispose()
+    for {
+        task := w.engine.next(w)
+        if task == nil {
+            return
         }
+        w.runTask(task)
+        w.setState(WS_IDLE, 0)
+        w.engine.done(task)
+    }
+}
+
+func (w *worker) dispose() {
+    for _, judger := range w.judgers {
+        judger.Dispose()
     }
 }
 
 func (e *Engine) newWorker() (*worker, error) {
-    judgers := make([]SpecialJudger, 0, len(e.judgers))
+    w := &worker{
+        judgers: make([]SpecialJudger, 0, len(e.judgers)),
+        engine: e,
+    }
     for _, judger := range e.judgers {
         j, err := judger.Clone()
         if err != nil {
+            w.dispose()
             return nil, err
         }
-        judgers = append(judgers, j)
+        w.judgers = append(w.judgers, j)
     }
-    return &worker{
-        judgers: judgers,
-        engine: e,
-    }, nil
+    return w, nil
 }
 
 // Spawns specific amount of workers.
@@ -264,19 +549,75 @@ func (e *Engine) SpawnWorkers(n int) error {
         if err != nil {
             return err
         }
+        e.lock.Lock()
+        if e.stopping {
+            e.lock.Unlock()
+            w.dispose()
+            return ErrEngineShutdown
+        }
+        w.id = e.workerCounter
+        e.workerCounter++
+        e.workers = append(e.workers, w)
+        e.alive.Add(1)
+        e.lock.Unlock()
         go w.poll()
     }
     return nil
 }
 
-// Shuts down all workers, after they have finished their current jobs.
-func (e *Engine) Shutdown() {
-    close(e.stopFlag)
+// Shuts down the engine.
+//
+// The engine stops accepting tasks immediately, and waits for workers
+// to finish every scheduled task. If ctx is done first, the remaining
+// tasks are cancelled, and their ids are returned. So are tasks left
+// in the queue when no worker is running.
+// Judgers are disposed after every worker exits.
+func (e *Engine) Shutdown(ctx context.Context) []uint64 {
+    e.lock.Lock()
+    e.stopping = true
+    e.notify()
+    e.lock.Unlock()
+    exited := make(chan any)
+    go func() {
+        e.alive.Wait()
+        close(exited)
+    }()
+    var unfinished []uint64
+    select {
+        case <-exited:
+        case <-ctx.Done(): {
+            e.lock.Lock()
+            tasks := slices.Clone(e.queue.tasks)
+            for _, t := range e.running {
+                tasks = append(tasks, t)
+            }
+            e.lock.Unlock()
+            for _, t := range tasks {
+                e.removeTask(t.id)
+                if t.cancel() {
+                    unfinished = append(unfinished, t.id)
+                }
+            }
+            <-exited
+        }
+    }
+    // Tasks no worker was left to run, e.g. if none were spawned.
+    e.lock.Lock()
+    left := slices.Clone(e.queue.tasks)
+    e.lock.Unlock()
+    for _, t := range left {
+        e.removeTask(t.id)
+        if t.cancel() {
+            unfinished = append(unfinished, t.id)
+        }
+    }
     for _, judger := range e.judgers {
         judger.Dispose()
     }
-    e.judgers = nil
-    e.stopFlag = make(chan any)
+    // only succeeds if every task cleaned up after itself
+    os.Remove(e.TempDirBase)
+    slices.Sort(unfinished)
+    return unfinished
 }
 
 // A task wraps around a [Job] that is assigned to a worker.
@@ -285,7 +626,24 @@ type Task struct {
     lock		sync.Mutex
     job			Job
     tempDir		string
-    listener	func(Job)
+    events		broadcaster
+    engine		*Engine
+    done		chan any
+    ctx			context.Context
+    stop		context.CancelFunc
+    cancelled	bool
+    // Set once EV_JOB_FINISHED is published, which closes done.
+    finished	bool
+    // Context carrying the task span.
+    trace		context.Context
+    span		Span
+    // Nil once the task leaves the queue.
+    queueSpan	Span
+    // Incremented for every state to save, guarded by lock.
+    version		uint64
+    // Serializes saving, so that older states never overwrite newer ones.
+    saveLock	sync.Mutex
+    saved		uint64
 }
 
 // Id of the task, usually incremented in each task.
@@ -294,33 +652,140 @@ func (t *Task) Id() uint64 {
 }
 
 // A snapshot of the current job.
+// The snapshot is a deep copy, safe to use from any goroutine.
 func (t *Task) SnapJob() Job {
     t.lock.Lock()
     defer t.lock.Unlock()
-    return t.job
+    return t.job.Clone()
 }
 
-func (t *Task) update(f func()) {
+// Current status of the job.
+func (t *Task) status() Status {
     t.lock.Lock()
     defer t.lock.Unlock()
-    f()
+    return t.job.Status
+}
+
+// Must be called with t.lock held. The returned function saves the job,
+// ends spans and retires the task if needed; it must be called once
+// t.lock is released, since it does disk I/O and calls user code.
+func (t *Task) publish(kind EventKind, index int) func() {
     t.job.Updated = time.Now()
-    if t.listener != nil {
-        go t.listener(t.job)
+    ev := Event{
+        Kind: kind,
+        Task: t.id,
+        Case: index,
+        Status: t.job.Status,
+        Time: t.job.Updated,
+    }
+    if index >= 0 {
+        ev.Status = t.job.Results[index].Status
+        ev.Result = t.job.Results[index].Clone()
+    }
+    t.events.publish(ev)
+    t.engine.events.publish(ev)
+    if kind == EV_JOB_FINISHED {
+        t.finished = true
+    }
+    if kind != EV_JOB_STARTED && kind != EV_JOB_FINISHED {
+        return func() {}
+    }
+    t.version++
+    version, job := t.version, t.snapshot()
+    queueSpan := t.queueSpan
+    t.queueSpan = nil
+    return func() {
+        if queueSpan != nil {
+            queueSpan.End()
+        }
+        t.save(version, job)
+        if kind == EV_JOB_FINISHED {
+            t.span.SetAttributes(slog.String("status", job.Status.Ident()))
+            t.span.End()
+            close(t.done)
+            t.engine.retire(t.id, job.Updated)
+        }
     }
 }
 
-func (t *Task) cancel() {
-    t.update(func() {
-        t.job.Status = ST_CANCELLED
-        for i := 0; i < len(t.job.Results); i++ {
-            t.job.Results[i].Status = ST_CANCELLED
-        }
-    })
+// A copy of the job to save. Cases are never modified,
+// so only the results are copied.
+// Must be called with t.lock held, or before the task is shared.
+func (t *Task) snapshot() Job {
+    job := t.job
+    job.Results = slices.Clone(job.Results)
+    return job
+}
+
+// Saves given version of the job, unless a newer one was saved.
+// Must be called without holding t.lock or e.lock.
+func (t *Task) save(version uint64, job Job) {
+    t.saveLock.Lock()
+    if version <= t.saved {
+        t.saveLock.Unlock()
+        return
+    }
+    t.saved = version
+    err := t.engine.persist(t.id, job)
+    t.saveLock.Unlock()
+    if err != nil {
+        t.engine.reportError(t.id, err)
+    }
 }
 
-// Adds a listeners that is called
-// every time the job updates.
-func (t *Task) Subscribe(listener func(Job)) {
-    t.listener = listener
-}
\ No newline at end of file
+// Applies f to the job, then publishes an event about
+// given result index (-1 for the job itself).
+// Updates are dropped once the task is cancelled or finished.
+func (t *Task) update(kind EventKind, index int, f func()) {
+    t.lock.Lock()
+    if t.cancelled || t.finished {
+        t.lock.Unlock()
+        return
+    }
+    f()
+    after := t.publish(kind, index)
+    t.lock.Unlock()
+    after()
+}
+
+// Returns false if the task has already finished.
+func (t *Task) cancel() bool {
+    defer t.stop()
+    t.lock.Lock()
+    if t.cancelled || t.finished {
+        t.lock.Unlock()
+        return false
+    }
+    t.job.Status = ST_CANCELLED
+    for i := 0; i < len(t.job.Results); i++ {
+        t.job.Results[i].Status = ST_CANCELLED
+    }
+    t.cancelled = true
+    after := t.publish(EV_JOB_FINISHED, -1)
+    t.lock.Unlock()
+    after()
+    return true
+}
+
+// Adds a listener that is called for every event of the task.
+// Each listener receives events one by one, in order,
+// without blocking the worker.
+func (t *Task) Subscribe(listener func(Event)) *Subscription {
+    return t.events.subscribe(listener)
+}
+
+// Returns a channel which is closed when the job finishes.
+func (t *Task) Done() <-chan any {
+    return t.done
+}
+
+// Blocks until the job finishes, and returns the final job.
+// If ctx is done first, returns the current snapshot and ctx.Err().
+func (t *Task) Wait(ctx context.Context) (Job, error) {
+    select {
+        case <-t.done:
+            return t.SnapJob(), nil
+        case <-ctx.Done():
+            return t.SnapJob(), ctx.Err()
+    }
+}
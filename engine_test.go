@@ -0,0 +1,248 @@
+package isfj
+
+import (
+    "context"
+    "errors"
+    "sync"
+    "testing"
+    "time"
+)
+
+// A script echoing its input, for the "sh" language of [newTestEngine].
+const catScript = "#!/bin/sh\ncat\n"
+
+// An engine whose "sh" language runs the code as a shell script.
+func newTestEngine(t *testing.T) *Engine {
+    t.Helper()
+    e := NewEngine(t.TempDir())
+    compiler, err := NewCompiler(`sh -c "cp {{ .Source }} {{ .Output }} && chmod +x {{ .Output }}"`)
+    if err != nil {
+        t.Fatal(err)
+    }
+    e.AddCompiler("sh", compiler)
+    return e
+}
+
+func newTestJob(cases int) Job {
+    init := JobInit{ Code: catScript, Lang: "sh" }
+    for i := 0; i < cases; i++ {
+        init.Cases = append(init.Cases, Case{ Stdin: "1 2\n", Stdout: "1 2\n", Points: 10 })
+    }
+    return NewJob(init)
+}
+
+// Schedules, snapshots, subscribes to and cancels tasks concurrently.
+// Meant to be run with -race.
+func TestEngineConcurrentAccess(t *testing.T) {
+    e := newTestEngine(t)
+    e.SetRetention(RetentionPolicy{ MaxCount: 100 })
+    e.SetCPUSlots(2)
+    if err := e.SpawnWorkers(2); err != nil {
+        t.Fatal(err)
+    }
+    ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+    defer cancel()
+    defer e.Shutdown(ctx)
+
+    events := e.Events(ctx)
+    go func() {
+        for ev := range events {
+            // events must not share results with the job
+            ev.Result.Extra = "mutated"
+        }
+    }()
+
+    // the same job is scheduled by every goroutine
+    job := newTestJob(3)
+    wg := sync.WaitGroup{}
+    for i := 0; i < 8; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            task, err := e.Schedule(job)
+            if err != nil {
+                t.Error(err)
+                return
+            }
+            finished := make(chan any)
+            sub := task.Subscribe(func(ev Event) {
+                ev.Result.Extra = "mutated"
+                if ev.Kind == EV_JOB_FINISHED {
+                    close(finished)
+                }
+            })
+            defer sub.Unsubscribe()
+            view, ok := e.GetTask(task.Id())
+            if !ok {
+                t.Errorf("task %d not found", task.Id())
+                return
+            }
+            for j := 0; j < 20; j++ {
+                snap := view.SnapJob()
+                snap.Results[0].Extra = "mutated"
+                snap.Cases[0].Stdin = "mutated"
+                e.QueuePosition(task.Id())
+                e.Workers()
+            }
+            if i % 2 == 1 {
+                e.CancelTask(task)
+            }
+            final, err := task.Wait(ctx)
+            if err != nil {
+                t.Error(err)
+                return
+            }
+            if i % 2 == 0 && final.Status != ST_ACCEPTED {
+                t.Errorf("task %d: expected %s, got %s", task.Id(), ST_ACCEPTED, final.Status)
+            }
+            if i % 2 == 1 && final.Status != ST_ACCEPTED && final.Status != ST_CANCELLED {
+                t.Errorf("task %d: expected %s or %s, got %s", task.Id(), ST_ACCEPTED, ST_CANCELLED, final.Status)
+            }
+            if final.Results[0].Extra == "mutated" || final.Cases[0].Stdin == "mutated" {
+                t.Errorf("task %d: job was modified through a copy", task.Id())
+            }
+            select {
+                case <-finished:
+                case <-ctx.Done():
+                    t.Errorf("task %d: %s not delivered", task.Id(), EV_JOB_FINISHED)
+            }
+        }()
+    }
+    wg.Wait()
+    if job.Results[0].Status != ST_WAITING {
+        t.Errorf("scheduled job was modified")
+    }
+}
+
+// Cancels tasks while they are queued, compiling and running.
+func TestEngineCancelWhileRunning(t *testing.T) {
+    e := newTestEngine(t)
+    if err := e.SpawnWorkers(2); err != nil {
+        t.Fatal(err)
+    }
+    ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+    defer cancel()
+    defer e.Shutdown(ctx)
+
+    job := newTestJob(2)
+    job.Code = "#!/bin/sh\nsleep 30\n"
+    var tasks []*Task
+    for i := 0; i < 4; i++ {
+        task, err := e.Schedule(job)
+        if err != nil {
+            t.Fatal(err)
+        }
+        tasks = append(tasks, task)
+    }
+    wg := sync.WaitGroup{}
+    for _, task := range tasks {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            e.CancelTask(task)
+        }()
+    }
+    wg.Wait()
+    for _, task := range tasks {
+        final, err := task.Wait(ctx)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if final.Status != ST_CANCELLED {
+            t.Errorf("task %d: expected %s, got %s", task.Id(), ST_CANCELLED, final.Status)
+        }
+    }
+}
+
+// Once a case of a group fails, the rest of the group is skipped,
+// if asked to.
+func TestEnginePackedGroupSkipped(t *testing.T) {
+    e := newTestEngine(t)
+    if err := e.SpawnWorkers(1); err != nil {
+        t.Fatal(err)
+    }
+    ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+    defer cancel()
+    defer e.Shutdown(ctx)
+
+    init := JobInit{ Code: catScript, Lang: "sh", Groups: [][]int{ { 3, 1, 2 }, { 4 } } }
+    for i := 0; i < 4; i++ {
+        init.Cases = append(init.Cases, Case{ Stdin: "1 2\n", Stdout: "1 2\n", Points: 10 })
+    }
+    init.Cases[0].Stdout = "3\n"
+    for _, skip := range []bool{ false, true } {
+        init.SkipGroups = skip
+        task, err := e.Schedule(NewJob(init))
+        if err != nil {
+            t.Fatal(err)
+        }
+        final, err := task.Wait(ctx)
+        if err != nil {
+            t.Fatal(err)
+        }
+        expected := []Status{ ST_WRONG_ANSWER, ST_ACCEPTED, ST_ACCEPTED, ST_ACCEPTED }
+        if skip {
+            expected[1] = ST_SKIPPED
+        }
+        for i, status := range expected {
+            if final.Results[i+1].Status != status {
+                t.Errorf("skip %v, case %d: expected %s, got %s", skip, i+1, status, final.Results[i+1].Status)
+            }
+        }
+        if final.Status != ST_WRONG_ANSWER {
+            t.Errorf("skip %v: expected %s, got %s", skip, ST_WRONG_ANSWER, final.Status)
+        }
+    }
+}
+
+// A finished task is never finished again, whatever its status.
+func TestTaskFinishedOnce(t *testing.T) {
+    e := newTestEngine(t)
+    e.lock.Lock()
+    task := e.newTask(1, newTestJob(1))
+    e.lock.Unlock()
+    // the status is left as ST_WAITING
+    task.update(EV_JOB_FINISHED, -1, func() {})
+    if task.cancel() {
+        t.Error("finished task cancelled")
+    }
+    task.update(EV_JOB_FINISHED, -1, func() {})
+    <-task.Done()
+    if job := task.SnapJob(); job.Status != ST_WAITING {
+        t.Errorf("finished task updated to %s", job.Status)
+    }
+}
+
+// Ungrouped cases would never run, leaving the job waiting.
+func TestScheduleRejectsUngroupedCase(t *testing.T) {
+    e := newTestEngine(t)
+    job := newTestJob(2)
+    job.Groups = [][]int{ { 1 } }
+    if _, err := e.Schedule(job); !errors.Is(err, ErrUngroupedCase) {
+        t.Errorf("expected %v, got %v", ErrUngroupedCase, err)
+    }
+    job.Groups = [][]int{ { 2 }, { 1 } }
+    if _, err := e.Schedule(job); err != nil {
+        t.Error(err)
+    }
+}
+
+func TestSetWorkers(t *testing.T) {
+    e := newTestEngine(t)
+    defer e.Shutdown(context.Background())
+    if err := e.SetWorkers(2); err != nil {
+        t.Fatal(err)
+    }
+    if err := e.SetWorkers(-1); !errors.Is(err, ErrNegativeWorkers) {
+        t.Errorf("expected %v, got %v", ErrNegativeWorkers, err)
+    }
+    if n := e.WorkerCount(); n != 2 {
+        t.Errorf("expected 2 workers, got %d", n)
+    }
+    if err := e.SetWorkers(0); err != nil {
+        t.Fatal(err)
+    }
+    if n := e.WorkerCount(); n != 0 {
+        t.Errorf("expected no workers, got %d", n)
+    }
+}
@@ -0,0 +1,119 @@
+package isfj
+
+import (
+    "errors"
+    "fmt"
+)
+
+// Reasons for a job to be rejected by [Engine.Schedule].
+// Use [errors.Is] on the returned error to check them.
+var (
+    ErrUnknownLanguage  = errors.New("unknown language")
+    ErrUnknownMode      = errors.New("unknown judge mode")
+    ErrUnknownJudger    = errors.New("unknown special judger")
+    ErrNoCases          = errors.New("no cases")
+    ErrGroupIndex       = errors.New("group index out of range")
+    ErrUngroupedCase    = errors.New("case not in any group")
+    ErrNeedleNotFound   = errors.New("needle not found")
+)
+
+var (
+    // Returned by [Engine.TrySchedule] when the queue is at capacity.
+    ErrQueueFull        = errors.New("queue is full")
+    // Returned when scheduling after [Engine.Shutdown].
+    ErrEngineShutdown   = errors.New("engine is shut down")
+    // Returned by [Engine.SetWorkers] for a negative count.
+    ErrNegativeWorkers  = errors.New("negative worker count")
+)
+
+// Error describing why a job is invalid.
+type ValidationError struct {
+    // Field of the job that is invalid.
+    Field   string
+    // One of the Err* reasons above.
+    Err     error
+    // Additional information, may be empty.
+    Detail  string
+}
+
+// Implements error.
+func (e *ValidationError) Error() string {
+    if e.Detail == "" {
+        return fmt.Sprintf("invalid job: %s: %v", e.Field, e.Err)
+    }
+    return fmt.Sprintf("invalid job: %s: %v: %s", e.Field, e.Err, e.Detail)
+}
+
+// Unwraps to the reason.
+func (e *ValidationError) Unwrap() error {
+    return e.Err
+}
+
+// A panic recovered from a worker.
+type PanicError struct {
+    // Value passed to panic.
+    Value   any
+    // Stack trace of the panicking goroutine.
+    Stack   []byte
+}
+
+// Implements error.
+func (e *PanicError) Error() string {
+    return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// Machine-readable code of a [SystemError].
+type ErrorCode string
+
+const (
+    // Not caused by a [SystemError].
+    EC_UNKNOWN          ErrorCode = "EC_UNKNOWN"
+    // Failed to create a temporary folder.
+    EC_MKDIR            ErrorCode = "EC_MKDIR"
+    // Failed to write a temporary file.
+    EC_WRITE_FILE       ErrorCode = "EC_WRITE_FILE"
+    // Failed to execute a command template.
+    EC_TEMPLATE         ErrorCode = "EC_TEMPLATE"
+    // Command produced by a template is malformed.
+    EC_COMMAND          ErrorCode = "EC_COMMAND"
+    // Failed to create a pipe.
+    EC_PIPE             ErrorCode = "EC_PIPE"
+    // Failed to start a process.
+    EC_START_PROCESS    ErrorCode = "EC_START_PROCESS"
+    // Failed to read the output of a process.
+    EC_READ_OUTPUT      ErrorCode = "EC_READ_OUTPUT"
+    // Failed to pin a process to its cores.
+    EC_AFFINITY         ErrorCode = "EC_AFFINITY"
+    // Special judger failed.
+    EC_JUDGER           ErrorCode = "EC_JUDGER"
+    // A worker panicked.
+    EC_PANIC            ErrorCode = "EC_PANIC"
+    // Failed to persist a job to the [TaskStore].
+    EC_STORE            ErrorCode = "EC_STORE"
+)
+
+// An error of the judging system itself,
+// as opposed to errors of the judged program.
+// Results in [ST_SYSTEM_ERROR].
+type SystemError struct {
+    // Machine-readable code.
+    Code    ErrorCode
+    // Operation that failed.
+    Op      string
+    // Underlying error.
+    Err     error
+}
+
+// Implements error.
+func (e *SystemError) Error() string {
+    return fmt.Sprintf("%s: %s: %v", e.Code, e.Op, e.Err)
+}
+
+// Unwraps to the underlying error.
+func (e *SystemError) Unwrap() error {
+    return e.Err
+}
+
+func systemError(code ErrorCode, op string, err error) *SystemError {
+    return &SystemError{ Code: code, Op: op, Err: err }
+}
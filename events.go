@@ -0,0 +1,193 @@
+package isfj
+
+import (
+    "context"
+    "slices"
+    "sync"
+    "time"
+)
+
+// Kind of an [Event].
+type EventKind uint8
+
+// Identifier of the event kind.
+func (k EventKind) Ident() string {
+    switch k {
+        case EV_JOB_STARTED:
+            return "EV_JOB_STARTED"
+        case EV_COMPILE_FINISHED:
+            return "EV_COMPILE_FINISHED"
+        case EV_CASE_STARTED:
+            return "EV_CASE_STARTED"
+        case EV_CASE_FINISHED:
+            return "EV_CASE_FINISHED"
+        case EV_JOB_FINISHED:
+            return "EV_JOB_FINISHED"
+    }
+    panic("All branches already covered.")
+}
+
+// Human-readable string representation.
+func (k EventKind) String() string {
+    switch k {
+        case EV_JOB_STARTED:
+            return "Job Started"
+        case EV_COMPILE_FINISHED:
+            return "Compile Finished"
+        case EV_CASE_STARTED:
+            return "Case Started"
+        case EV_CASE_FINISHED:
+            return "Case Finished"
+        case EV_JOB_FINISHED:
+            return "Job Finished"
+    }
+    panic("All branches already covered.")
+}
+
+const (
+    // A worker picked up the job.
+    EV_JOB_STARTED EventKind = iota
+    // Case 0 finished compiling.
+    EV_COMPILE_FINISHED
+    // Case 1~n started running.
+    EV_CASE_STARTED
+    // Case 1~n has its final result.
+    EV_CASE_FINISHED
+    // The job finished, including being cancelled.
+    // No events follow this one.
+    EV_JOB_FINISHED
+)
+
+// Something that happened to a task.
+type Event struct {
+    Kind    EventKind
+    // Id of the task.
+    Task    uint64
+    // Index into [Job.Results], -1 for job events.
+    Case    int
+    // Status of the job for job events,
+    // status of the case otherwise.
+    Status  Status
+    // Result of the case.
+    // Only available for case events.
+    Result  CaseResult
+    // Time of the event.
+    Time    time.Time
+}
+
+// A listener registered by Subscribe.
+type Subscription struct {
+    listener    func(Event)
+    owner       *broadcaster
+    lock        sync.Mutex
+    pending     []Event
+    delivering  bool
+    closed      bool
+}
+
+// Stops delivering events to the listener.
+// Events already being delivered are not interrupted.
+func (s *Subscription) Unsubscribe() {
+    s.owner.remove(s)
+    s.lock.Lock()
+    defer s.lock.Unlock()
+    s.closed = true
+    s.pending = nil
+}
+
+// Queues the event without blocking.
+// Events are delivered one by one, in order.
+func (s *Subscription) deliver(ev Event) {
+    s.lock.Lock()
+    defer s.lock.Unlock()
+    if s.closed {
+        return
+    }
+    s.pending = append(s.pending, ev)
+    if !s.delivering {
+        s.delivering = true
+        go s.drain()
+    }
+}
+
+func (s *Subscription) drain() {
+    for {
+        s.lock.Lock()
+        if len(s.pending) == 0 {
+            s.delivering = false
+            s.lock.Unlock()
+            return
+        }
+        ev := s.pending[0]
+        s.pending = s.pending[1:]
+        s.lock.Unlock()
+        s.listener(ev)
+    }
+}
+
+// Fans events out to subscriptions.
+type broadcaster struct {
+    lock            sync.Mutex
+    subscriptions   []*Subscription
+}
+
+func (b *broadcaster) subscribe(listener func(Event)) *Subscription {
+    s := &Subscription{
+        listener: listener,
+        owner: b,
+    }
+    b.lock.Lock()
+    defer b.lock.Unlock()
+    b.subscriptions = append(b.subscriptions, s)
+    return s
+}
+
+func (b *broadcaster) remove(s *Subscription) {
+    b.lock.Lock()
+    defer b.lock.Unlock()
+    b.subscriptions = slices.DeleteFunc(b.subscriptions, func(x *Subscription) bool { return x == s })
+}
+
+func (b *broadcaster) publish(ev Event) {
+    b.lock.Lock()
+    defer b.lock.Unlock()
+    for _, s := range b.subscriptions {
+        s.deliver(ev)
+    }
+}
+
+// Adds a listener that is called for every event of every task.
+// Each listener receives events one by one, in order,
+// without blocking the workers.
+func (e *Engine) Subscribe(listener func(Event)) *Subscription {
+    return e.events.subscribe(listener)
+}
+
+// Returns a stream of the events of every task.
+// The channel is closed once ctx is done.
+// Events are held back until the channel is read.
+func (e *Engine) Events(ctx context.Context) <-chan Event {
+    ch := make(chan Event)
+    lock := sync.Mutex{}
+    closed := false
+    sub := e.events.subscribe(func(ev Event) {
+        lock.Lock()
+        defer lock.Unlock()
+        if closed {
+            return
+        }
+        select {
+            case ch <- ev:
+            case <-ctx.Done():
+        }
+    })
+    go func() {
+        <-ctx.Done()
+        sub.Unsubscribe()
+        lock.Lock()
+        defer lock.Unlock()
+        closed = true
+        close(ch)
+    }()
+    return ch
+}
@@ -7,3 +7,5 @@ require golang.org/x/sys v0.25.0
 require github.com/google/shlex v0.0.0-20191202100458-e7afc7fbc510
 
 require github.com/yuin/gopher-lua v1.1.1
+
+require gopkg.in/yaml.v3 v3.0.1
@@ -2,6 +2,9 @@ package isfj
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"math/rand"
 	"os"
 	"os/exec"
@@ -10,7 +13,6 @@ import (
 	"strings"
 	"text/template"
 
-	"github.com/google/shlex"
 	lua "github.com/yuin/gopher-lua"
 )
 
@@ -58,16 +60,28 @@ func StrictJudge(got, expected string) bool {
 // Judger for [J_SPECIAL].
 type SpecialJudger interface {
     // Compares two strings, with an additional temporary folder.
-    Judge(got, expected, tempDir string) Status
+    // A non-nil error means the judger itself failed,
+    // which results in [ST_SYSTEM_ERROR].
+    // Judging should stop once ctx is done.
+    Judge(ctx context.Context, got, expected, tempDir string) (Status, error)
     // Clones this judger to avoid concurrency issues.
     Clone() (SpecialJudger, error)
     // Dispose of this judger.
     Dispose()
 }
 
+// A [SpecialJudger] which also needs the input of the case.
+// JudgeInput is called instead of Judge.
+type InputJudger interface {
+    SpecialJudger
+    JudgeInput(ctx context.Context, input, got, expected, tempDir string) (Status, error)
+}
+
 // An implementation of [SpecialJudger] which
 // calls an external program to compare.
 type ExternalJudger struct {
+    // Working directory of the command, the current one if empty.
+    Dir     string
     command	*template.Template
 }
 
@@ -91,16 +105,16 @@ func NewExternalJudger(templ string) (*ExternalJudger, error) {
 }
 
 // Implements [SpecialJudger].
-func (s *ExternalJudger) Judge(got, expected, tempDir string) Status {
+func (s *ExternalJudger) Judge(ctx context.Context, got, expected, tempDir string) (Status, error) {
     gotFile := path.Join(tempDir, randName("spj_got_"))
     err := os.WriteFile(gotFile, []byte(got), 0o666)
     if err != nil {
-        return ST_SYSTEM_ERROR
+        return ST_SYSTEM_ERROR, systemError(EC_WRITE_FILE, "write judger input", err)
     }
     expectedFile := path.Join(tempDir, randName("spj_exp_"))
     err = os.WriteFile(expectedFile, []byte(expected), 0o666)
     if err != nil {
-        return ST_SYSTEM_ERROR
+        return ST_SYSTEM_ERROR, systemError(EC_WRITE_FILE, "write judger input", err)
     }
     buf := bytes.Buffer{}
     err = s.command.Execute(&buf, judgerTemplateData{
@@ -108,15 +122,27 @@ func (s *ExternalJudger) Judge(got, expected, tempDir string) Status {
         Expected: expectedFile,
     })
     if err != nil {
-        return ST_SYSTEM_ERROR
+        return ST_SYSTEM_ERROR, systemError(EC_TEMPLATE, "execute judger template", err)
+    }
+    args, err := splitCommand(buf.String())
+    if err != nil {
+        return ST_SYSTEM_ERROR, systemError(EC_COMMAND, "parse judger command", err)
+    }
+    cmd := commandContext(ctx, args[0], args[1:]...)
+    cmd.Dir = s.Dir
+    err = cmd.Run()
+    if ctx.Err() != nil {
+        return ST_CANCELLED, nil
+    }
+    if err != nil {
+        if _, ok := err.(*exec.ExitError); !ok {
+            return ST_SYSTEM_ERROR, systemError(EC_START_PROCESS, "run judger", err)
+        }
     }
-    args, _ := shlex.Split(buf.String())
-    cmd := exec.Command(args[0], args[1:]...)
-    cmd.Run()
     if cmd.ProcessState.ExitCode() == 0 {
-        return ST_ACCEPTED
+        return ST_ACCEPTED, nil
     } else {
-        return ST_WRONG_ANSWER
+        return ST_WRONG_ANSWER, nil
     }
 }
 
@@ -124,6 +150,7 @@ func (s *ExternalJudger) Judge(got, expected, tempDir string) Status {
 func (s *ExternalJudger) Clone() (SpecialJudger, error) {
     commandClone, err := s.command.Clone()
     return &ExternalJudger{
+        Dir: s.Dir,
         command: commandClone,
     }, err
 }
@@ -131,6 +158,68 @@ func (s *ExternalJudger) Clone() (SpecialJudger, error) {
 // Implements [SpecialJudger].
 func (s *ExternalJudger) Dispose() {}
 
+// An implementation of [InputJudger] which runs a compiled
+// testlib checker as "checker <input> <output> <answer>".
+//
+// Exit code 0 means accepted, 1 (wrong answer) and 2 (presentation error)
+// mean wrong answer, anything else means the checker failed.
+type TestlibChecker struct {
+    // Absolute path of the checker executable.
+    Executable  string
+}
+
+// Creates a [TestlibChecker] running given executable.
+func NewTestlibChecker(executable string) *TestlibChecker {
+    return &TestlibChecker{ Executable: executable }
+}
+
+// Implements [SpecialJudger], with an empty input.
+func (t *TestlibChecker) Judge(ctx context.Context, got, expected, tempDir string) (Status, error) {
+    return t.JudgeInput(ctx, "", got, expected, tempDir)
+}
+
+// Implements [InputJudger].
+func (t *TestlibChecker) JudgeInput(ctx context.Context, input, got, expected, tempDir string) (Status, error) {
+    files := []string{ input, got, expected }
+    for i, prefix := range []string{ "chk_in_", "chk_out_", "chk_ans_" } {
+        name := path.Join(tempDir, randName(prefix))
+        if err := os.WriteFile(name, []byte(files[i]), 0o666); err != nil {
+            return ST_SYSTEM_ERROR, systemError(EC_WRITE_FILE, "write checker input", err)
+        }
+        files[i] = name
+    }
+    cmd := commandContext(ctx, t.Executable, files...)
+    log := &cappedBuffer{ limit: DefaultCompilerOutputLimit }
+    cmd.Stdout = log
+    cmd.Stderr = log
+    err := cmd.Run()
+    if ctx.Err() != nil {
+        return ST_CANCELLED, nil
+    }
+    if err != nil {
+        if _, ok := err.(*exec.ExitError); !ok {
+            return ST_SYSTEM_ERROR, systemError(EC_START_PROCESS, "run checker", err)
+        }
+    }
+    switch code := cmd.ProcessState.ExitCode(); code {
+        case 0:
+            return ST_ACCEPTED, nil
+        case 1, 2:
+            return ST_WRONG_ANSWER, nil
+        default:
+            return ST_SYSTEM_ERROR, systemError(EC_JUDGER, "run checker",
+                fmt.Errorf("exit code %d: %s", code, strings.TrimSpace(log.String())))
+    }
+}
+
+// Implements [SpecialJudger].
+func (t *TestlibChecker) Clone() (SpecialJudger, error) {
+    return &TestlibChecker{ Executable: t.Executable }, nil
+}
+
+// Implements [SpecialJudger].
+func (t *TestlibChecker) Dispose() {}
+
 // An implementation of [SpecialJudger] which
 // uses a embedded Lua engine to execute scripts.
 //
@@ -171,26 +260,31 @@ func NewLuaJudger(code string) (*LuaJudger, error) {
 }
 
 // Implements [SpecialJudger].
-func (l *LuaJudger) Judge(got, expected, tempDir string) Status {
+func (l *LuaJudger) Judge(ctx context.Context, got, expected, tempDir string) (Status, error) {
+    l.state.SetContext(ctx)
+    defer l.state.RemoveContext()
     l.state.SetGlobal("tempdir", lua.LString(tempDir))
     err := l.state.DoString(l.Code)
     if err != nil {
-        return ST_SYSTEM_ERROR
+        return ST_SYSTEM_ERROR, systemError(EC_JUDGER, "load lua script", err)
     }
     judgeFunc, ok := l.state.GetGlobal("judge").(*lua.LFunction)
     if !ok {
-        return ST_SYSTEM_ERROR
+        return ST_SYSTEM_ERROR, systemError(EC_JUDGER, "load lua script", errors.New("function judge is not defined"))
     }
     if err := l.state.CallByParam(lua.P{
         Fn:      judgeFunc,
         NRet:    1,
         Protect: true,
     }, lua.LString(got), lua.LString(expected)); err != nil {
-        return ST_SYSTEM_ERROR
+        if ctx.Err() != nil {
+            return ST_CANCELLED, nil
+        }
+        return ST_SYSTEM_ERROR, systemError(EC_JUDGER, "call judge", err)
     }
     code := lua.LVAsNumber(l.state.Get(-1))
     l.state.Pop(-1)
-    return Status(code)
+    return Status(code), nil
 }
 
 // Implements [SpecialJudger].
@@ -0,0 +1,60 @@
+package isfj
+
+import (
+    "context"
+    "log/slog"
+    "time"
+)
+
+// Drops every record, used when no logger is set.
+type discardHandler struct {}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+func (h discardHandler) WithGroup(string) slog.Handler { return h }
+
+var discardLogger = slog.New(discardHandler{})
+
+// Sets the logger of this engine.
+// Jobs are logged at [slog.LevelInfo], compilations and cases
+// at [slog.LevelDebug], and internal failures at [slog.LevelError].
+// Nothing is logged by default.
+func (e *Engine) SetLogger(logger *slog.Logger) {
+    e.lock.Lock()
+    defer e.lock.Unlock()
+    e.logger = logger
+}
+
+func (e *Engine) getLogger() *slog.Logger {
+    e.lock.Lock()
+    defer e.lock.Unlock()
+    if e.logger == nil {
+        return discardLogger
+    }
+    return e.logger
+}
+
+// Logger with the attributes of given task.
+func (w *worker) logger(task *Task) *slog.Logger {
+    return w.engine.getLogger().With(
+        slog.Uint64("task", task.id),
+        slog.String("lang", task.job.Lang),
+        slog.Int("worker", w.id),
+    )
+}
+
+// Attribute of an error, empty if err is nil.
+func errorAttr(err error) slog.Attr {
+    if err == nil {
+        return slog.Attr{}
+    }
+    return slog.Group("error",
+        slog.String("message", err.Error()),
+        slog.String("code", string(errorCode(err))),
+    )
+}
+
+func durationAttr(start time.Time) slog.Attr {
+    return slog.Duration("duration", time.Since(start))
+}
@@ -0,0 +1,292 @@
+package isfj
+
+import (
+    "errors"
+    "fmt"
+    "io"
+    "maps"
+    "net/http"
+    "slices"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+)
+
+// Instrumentation hook of an [Engine], see [Engine.SetMetrics].
+// Methods are called from workers, and must not block.
+// QueueChanged is called while the engine is locked,
+// and must not call back into the engine.
+type Metrics interface {
+    // A task was scheduled to given queue.
+    TaskScheduled(queue string)
+    // Tasks waiting for a worker & running changed.
+    QueueChanged(waiting, running int)
+    // Case 0 of a job finished compiling.
+    CompileFinished(lang string, status Status, duration time.Duration)
+    // Case 1~n of a job finished running.
+    CaseFinished(lang string, status Status, usages Usages)
+    // A special judger finished judging a case.
+    JudgeFinished(judger int, status Status, duration time.Duration)
+    // A job finished, including being cancelled.
+    JobFinished(lang string, status Status, duration time.Duration)
+    // A worker encountered an internal failure.
+    SystemError(code ErrorCode)
+}
+
+// Sets the instrumentation hook of this engine.
+// Use [NewPrometheusMetrics] for a built-in exporter.
+func (e *Engine) SetMetrics(metrics Metrics) {
+    e.lock.Lock()
+    defer e.lock.Unlock()
+    e.metrics = metrics
+}
+
+// Returns the instrumentation hook, nil if none.
+func (e *Engine) getMetrics() Metrics {
+    e.lock.Lock()
+    defer e.lock.Unlock()
+    return e.metrics
+}
+
+// Code of given error, [EC_UNKNOWN] if not a [*SystemError].
+func errorCode(err error) ErrorCode {
+    var sysErr *SystemError
+    if errors.As(err, &sysErr) {
+        return sysErr.Code
+    }
+    return EC_UNKNOWN
+}
+
+// Upper bounds of histogram buckets, in seconds.
+var (
+    compileBuckets  = []float64{ 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30 }
+    runtimeBuckets  = []float64{ 0.001, 0.005, 0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10 }
+    judgeBuckets    = []float64{ 0.001, 0.01, 0.1, 0.5, 1, 5 }
+    jobBuckets      = []float64{ 0.5, 1, 2.5, 5, 10, 30, 60, 300 }
+)
+
+type histogram struct {
+    buckets []float64
+    counts  []uint64
+    sum     float64
+    count   uint64
+}
+
+func newHistogram(buckets []float64) *histogram {
+    return &histogram{
+        buckets: buckets,
+        counts: make([]uint64, len(buckets)),
+    }
+}
+
+func (h *histogram) observe(value float64) {
+    for i, bound := range h.buckets {
+        if value <= bound {
+            h.counts[i]++
+        }
+    }
+    h.sum += value
+    h.count++
+}
+
+// A metric family with labels.
+type family struct {
+    name    string
+    help    string
+    kind    string
+    labels  []string
+    buckets []float64
+    values  map[string]float64
+    hists   map[string]*histogram
+}
+
+func newFamily(name, kind, help string, labels ...string) *family {
+    return &family{
+        name: name,
+        help: help,
+        kind: kind,
+        labels: labels,
+        values: map[string]float64{},
+        hists: map[string]*histogram{},
+    }
+}
+
+func newHistogramFamily(name, help string, buckets []float64, labels ...string) *family {
+    f := newFamily(name, "histogram", help, labels...)
+    f.buckets = buckets
+    return f
+}
+
+func escapeLabel(value string) string {
+    value = strings.ReplaceAll(value, `\`, `\\`)
+    value = strings.ReplaceAll(value, "\n", `\n`)
+    return strings.ReplaceAll(value, `"`, `\"`)
+}
+
+// Formats label pairs, e.g. `lang="c",status="ST_ACCEPTED"`.
+func (f *family) key(values ...string) string {
+    pairs := make([]string, len(f.labels))
+    for i, label := range f.labels {
+        pairs[i] = fmt.Sprintf(`%s="%s"`, label, escapeLabel(values[i]))
+    }
+    return strings.Join(pairs, ",")
+}
+
+func (f *family) add(delta float64, values ...string) {
+    f.values[f.key(values...)] += delta
+}
+
+func (f *family) set(value float64, values ...string) {
+    f.values[f.key(values...)] = value
+}
+
+func (f *family) observe(value float64, values ...string) {
+    key := f.key(values...)
+    h, ok := f.hists[key]
+    if !ok {
+        h = newHistogram(f.buckets)
+        f.hists[key] = h
+    }
+    h.observe(value)
+}
+
+func formatFloat(value float64) string {
+    return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func braced(labels ...string) string {
+    labels = slices.DeleteFunc(labels, func(s string) bool { return s == "" })
+    if len(labels) == 0 {
+        return ""
+    }
+    return "{" + strings.Join(labels, ",") + "}"
+}
+
+func (f *family) write(w io.Writer) {
+    fmt.Fprintf(w, "# HELP %s %s\n", f.name, f.help)
+    fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.kind)
+    if f.kind != "histogram" {
+        for _, key := range slices.Sorted(maps.Keys(f.values)) {
+            fmt.Fprintf(w, "%s%s %s\n", f.name, braced(key), formatFloat(f.values[key]))
+        }
+        return
+    }
+    for _, key := range slices.Sorted(maps.Keys(f.hists)) {
+        h := f.hists[key]
+        for i, bound := range h.buckets {
+            le := fmt.Sprintf(`le="%s"`, formatFloat(bound))
+            fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, braced(key, le), h.counts[i])
+        }
+        fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, braced(key, `le="+Inf"`), h.count)
+        fmt.Fprintf(w, "%s_sum%s %s\n", f.name, braced(key), formatFloat(h.sum))
+        fmt.Fprintf(w, "%s_count%s %d\n", f.name, braced(key), h.count)
+    }
+}
+
+// A [Metrics] which exports metrics in the Prometheus text format.
+// Serve it over HTTP, e.g. at /metrics, to let Prometheus scrape it.
+type PrometheusMetrics struct {
+    lock        sync.Mutex
+    scheduled   *family
+    waiting     *family
+    running     *family
+    compiles    *family
+    compileTime *family
+    verdicts    *family
+    runtime     *family
+    judgeTime   *family
+    jobs        *family
+    jobTime     *family
+    errors      *family
+}
+
+// Creates an exporter with no samples.
+func NewPrometheusMetrics() *PrometheusMetrics {
+    return &PrometheusMetrics{
+        scheduled: newFamily("isfj_tasks_scheduled_total", "counter", "Tasks scheduled.", "queue"),
+        waiting: newFamily("isfj_queue_depth", "gauge", "Tasks waiting for a worker."),
+        running: newFamily("isfj_tasks_running", "gauge", "Tasks being run by workers."),
+        compiles: newFamily("isfj_compilations_total", "counter", "Compilations by result.", "lang", "status"),
+        compileTime: newHistogramFamily("isfj_compile_duration_seconds", "Compile latency.", compileBuckets, "lang"),
+        verdicts: newFamily("isfj_case_verdicts_total", "counter", "Case verdicts by status.", "lang", "status"),
+        runtime: newHistogramFamily("isfj_case_runtime_seconds", "CPU time of cases.", runtimeBuckets, "lang"),
+        judgeTime: newHistogramFamily("isfj_judge_duration_seconds", "Special judger latency.", judgeBuckets, "judger"),
+        jobs: newFamily("isfj_jobs_total", "counter", "Finished jobs by status.", "lang", "status"),
+        jobTime: newHistogramFamily("isfj_job_duration_seconds", "Time from starting to finishing a job.", jobBuckets, "lang"),
+        errors: newFamily("isfj_system_errors_total", "counter", "Internal failures by error code.", "code"),
+    }
+}
+
+// Implements [Metrics].
+func (m *PrometheusMetrics) TaskScheduled(queue string) {
+    m.lock.Lock()
+    defer m.lock.Unlock()
+    m.scheduled.add(1, queue)
+}
+
+// Implements [Metrics].
+func (m *PrometheusMetrics) QueueChanged(waiting, running int) {
+    m.lock.Lock()
+    defer m.lock.Unlock()
+    m.waiting.set(float64(waiting))
+    m.running.set(float64(running))
+}
+
+// Implements [Metrics].
+func (m *PrometheusMetrics) CompileFinished(lang string, status Status, duration time.Duration) {
+    m.lock.Lock()
+    defer m.lock.Unlock()
+    m.compiles.add(1, lang, status.Ident())
+    m.compileTime.observe(duration.Seconds(), lang)
+}
+
+// Implements [Metrics].
+func (m *PrometheusMetrics) CaseFinished(lang string, status Status, usages Usages) {
+    m.lock.Lock()
+    defer m.lock.Unlock()
+    m.verdicts.add(1, lang, status.Ident())
+    m.runtime.observe(float64(usages.Time) / 1e6, lang)
+}
+
+// Implements [Metrics].
+func (m *PrometheusMetrics) JudgeFinished(judger int, status Status, duration time.Duration) {
+    m.lock.Lock()
+    defer m.lock.Unlock()
+    m.judgeTime.observe(duration.Seconds(), strconv.Itoa(judger))
+}
+
+// Implements [Metrics].
+func (m *PrometheusMetrics) JobFinished(lang string, status Status, duration time.Duration) {
+    m.lock.Lock()
+    defer m.lock.Unlock()
+    m.jobs.add(1, lang, status.Ident())
+    m.jobTime.observe(duration.Seconds(), lang)
+}
+
+// Implements [Metrics].
+func (m *PrometheusMetrics) SystemError(code ErrorCode) {
+    m.lock.Lock()
+    defer m.lock.Unlock()
+    m.errors.add(1, string(code))
+}
+
+// Writes every metric in the Prometheus text format.
+func (m *PrometheusMetrics) Export(w io.Writer) {
+    m.lock.Lock()
+    defer m.lock.Unlock()
+    for _, f := range []*family{
+        m.scheduled, m.waiting, m.running,
+        m.compiles, m.compileTime,
+        m.verdicts, m.runtime,
+        m.judgeTime, m.jobs, m.jobTime, m.errors,
+    } {
+        f.write(w)
+    }
+}
+
+// Serves the metrics, implements [http.Handler].
+func (m *PrometheusMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+    m.Export(w)
+}
@@ -1,6 +1,10 @@
 package isfj
 
 import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
 	"time"
 )
 
@@ -120,6 +124,32 @@ func (m JudgeMode) JudgerId() int {
     return int((m & 0xff00) >> 8)
 }
 
+// Identifier of the mode bits.
+func (m JudgeMode) Ident() string {
+    switch m.ModeBits() {
+        case J_LAX:
+            return "J_LAX"
+        case J_STRICT:
+            return "J_STRICT"
+        case J_SPECIAL:
+            return "J_SPECIAL"
+    }
+    panic("All branches already covered.")
+}
+
+// Human-readable string representation.
+func (m JudgeMode) String() string {
+    switch m.ModeBits() {
+        case J_LAX:
+            return "Lax"
+        case J_STRICT:
+            return "Strict"
+        case J_SPECIAL:
+            return fmt.Sprintf("Special (judger %d)", m.JudgerId())
+    }
+    panic("All branches already covered.")
+}
+
 const (
     // Lax judging.
     J_LAX JudgeMode = iota
@@ -137,43 +167,96 @@ func MakeSpecialJudgeMode(judger int) JudgeMode {
 // Case type.
 // Usage should be superficial.
 type Case struct {
-    Stdin   string
-    Stdout  string
-    Args    []string
-    Limits  Limits
-    Points  int
+    Stdin   string      `json:"stdin" yaml:"stdin"`
+    Stdout  string      `json:"stdout" yaml:"stdout"`
+    Args    []string    `json:"args" yaml:"args"`
+    Limits  Limits      `json:"limits" yaml:"limits"`
+    Points  int         `json:"points" yaml:"points"`
 }
 
 // Result of judging a case.
 type CaseResult struct {
-    Status  Status
-    Usages  Usages
-    Points  int
-    Extra   string
+    Status  Status  `json:"status" yaml:"status"`
+    Usages  Usages  `json:"usages" yaml:"usages"`
+    Points  int     `json:"points" yaml:"points"`
+    Extra   string  `json:"extra" yaml:"extra"`
+    // Parsed compiler output, only set on case 0.
+    Diagnostics []Diagnostic    `json:"diagnostics,omitempty" yaml:"diagnostics,omitempty"`
+    // Description of the error.
+    // Only available if Status == [ST_SYSTEM_ERROR].
+    Error       string          `json:"error,omitempty" yaml:"error,omitempty"`
+    // Machine-readable code of the error.
+    // Only available if Status == [ST_SYSTEM_ERROR].
+    ErrorCode   ErrorCode       `json:"errorCode,omitempty" yaml:"errorCode,omitempty"`
+}
+
+// Marks this result as a system error.
+func (r *CaseResult) fail(err error) {
+    r.Status = ST_SYSTEM_ERROR
+    r.Error = err.Error()
+    r.ErrorCode = errorCode(err)
+    r.Extra = r.Error
+    var panicErr *PanicError
+    if errors.As(err, &panicErr) {
+        r.Extra += "\n" + string(panicErr.Stack)
+    }
 }
 
 // Arguments passed to [NewJob].
 type JobInit struct {
-    Code    string
-    Lang    string
-    Needle  string
-    Mode    JudgeMode
-    Cases   []Case
-    Groups  [][]int
+    Code    string      `json:"code" yaml:"code"`
+    Lang    string      `json:"lang" yaml:"lang"`
+    Needle  string      `json:"needle" yaml:"needle"`
+    Mode    JudgeMode   `json:"mode" yaml:"mode"`
+    Cases   []Case      `json:"cases" yaml:"cases"`
+    // Indices of cases starting from 1, nil to run every case at once.
+    // Otherwise every case must belong to a group.
+    // Groups are run in parallel and cases of a group in order.
+    Groups  [][]int     `json:"groups" yaml:"groups"`
+    // Once a case of a group is not accepted, skip the rest of the group,
+    // e.g. for subtasks scored all or nothing.
+    SkipGroups  bool    `json:"skipGroups" yaml:"skipGroups"`
+    // Tasks with higher priorities are picked up first.
+    Priority    int     `json:"priority" yaml:"priority"`
+    // Label of the queue, e.g. a tenant.
+    // Used for fair share and per-queue worker limits.
+    Queue       string  `json:"queue" yaml:"queue"`
 }
 
 // A job contains a collection of cases
 // to be judged against.
 type Job struct {
-    Code    string
-    Lang    string
-    Needle  string
-    Status  Status
-    Mode    JudgeMode
-    Cases   []Case
-    Groups  [][]int
-    Results []CaseResult
-    Updated time.Time
+    Code    string          `json:"code" yaml:"code"`
+    Lang    string          `json:"lang" yaml:"lang"`
+    Needle  string          `json:"needle" yaml:"needle"`
+    Status  Status          `json:"status" yaml:"status"`
+    Mode    JudgeMode       `json:"mode" yaml:"mode"`
+    Cases   []Case          `json:"cases" yaml:"cases"`
+    Groups  [][]int         `json:"groups" yaml:"groups"`
+    SkipGroups  bool        `json:"skipGroups" yaml:"skipGroups"`
+    Results []CaseResult    `json:"results" yaml:"results"`
+    Updated time.Time       `json:"updated" yaml:"updated"`
+    Priority    int         `json:"priority" yaml:"priority"`
+    Queue       string      `json:"queue" yaml:"queue"`
+    // Times the job was restarted after the engine
+    // stopped while running it. See [Engine.Recover].
+    Restarts    int         `json:"restarts" yaml:"restarts"`
+}
+
+// Returns a deep copy of this result.
+func (r CaseResult) Clone() CaseResult {
+    r.Diagnostics = slices.Clone(r.Diagnostics)
+    return r
+}
+
+// Results of a job with n cases, before anything ran.
+// Programs which never ran were not pinned to any core.
+func newResults(n int) []CaseResult {
+    results := make([]CaseResult, n+1)
+    for i := range results {
+        results[i].Usages.CPU = -1
+    }
+    return results
 }
 
 // Creates a new job using given arguments.
@@ -186,12 +269,80 @@ func NewJob(init JobInit) Job {
         Mode: init.Mode,
         Cases: init.Cases,
         Groups: init.Groups,
-        Results: make([]CaseResult, len(init.Cases)+1),
+        SkipGroups: init.SkipGroups,
+        Results: newResults(len(init.Cases)),
         Updated: time.Now(),
+        Priority: init.Priority,
+        Queue: init.Queue,
+    }
+}
+
+// Returns a deep copy of this job,
+// which shares no slices with the original.
+func (j Job) Clone() Job {
+    j.Cases = slices.Clone(j.Cases)
+    for i := 0; i < len(j.Cases); i++ {
+        j.Cases[i].Args = slices.Clone(j.Cases[i].Args)
+    }
+    j.Groups = slices.Clone(j.Groups)
+    for i := 0; i < len(j.Groups); i++ {
+        j.Groups[i] = slices.Clone(j.Groups[i])
+    }
+    j.Results = slices.Clone(j.Results)
+    for i := 0; i < len(j.Results); i++ {
+        j.Results[i] = j.Results[i].Clone()
     }
+    return j
 }
 
 // Checks whether this job is neither waiting nor running.
 func (j Job) Finished() bool {
     return j.Status != ST_WAITING && j.Status != ST_RUNNING
+}
+
+// Checks whether this job can be executed.
+// Languages and special judgers are checked by [Engine.Validate],
+// since they depend on the engine.
+func (j Job) Validate() error {
+    if len(j.Cases) == 0 {
+        return &ValidationError{ Field: "Cases", Err: ErrNoCases }
+    }
+    if j.Mode.ModeBits() > J_SPECIAL {
+        return &ValidationError{
+            Field: "Mode",
+            Err: ErrUnknownMode,
+            Detail: fmt.Sprintf("mode bits %d", j.Mode.ModeBits()),
+        }
+    }
+    // Only grouped cases are run, so every case must be in a group.
+    grouped := make([]bool, len(j.Cases)+1)
+    for g, group := range j.Groups {
+        for _, i := range group {
+            if i < 1 || i > len(j.Cases) {
+                return &ValidationError{
+                    Field: "Groups",
+                    Err: ErrGroupIndex,
+                    Detail: fmt.Sprintf("group %d refers to case %d, expected 1~%d", g, i, len(j.Cases)),
+                }
+            }
+            grouped[i] = true
+        }
+    }
+    if j.Groups != nil {
+        for i := 1; i <= len(j.Cases); i++ {
+            if !grouped[i] {
+                return &ValidationError{
+                    Field: "Groups",
+                    Err: ErrUngroupedCase,
+                    Detail: fmt.Sprintf("case %d", i),
+                }
+            }
+        }
+    }
+    if j.Needle != "" {
+        if _, err := os.Stat(j.Needle); err != nil {
+            return &ValidationError{ Field: "Needle", Err: ErrNeedleNotFound, Detail: err.Error() }
+        }
+    }
+    return nil
 }
\ No newline at end of file
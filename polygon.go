@@ -0,0 +1,381 @@
+package isfj
+
+import (
+    "archive/zip"
+    "context"
+    "encoding/xml"
+    "errors"
+    "fmt"
+    "io/fs"
+    "math"
+    "os"
+    "path"
+    "path/filepath"
+    "strconv"
+    "strings"
+)
+
+// Engine languages of Polygon source types, by the part before
+// the first dot, e.g. "cpp" for "cpp.g++17".
+// Used by [Engine.AddPolygonChecker] to pick a compiler.
+var PolygonLanguages = map[string]string{
+    "c": "c",
+    "cpp": "cpp",
+    "java": "java",
+    "python": "python",
+    "pas": "pascal",
+}
+
+// A source file of a Polygon package.
+type PolygonSource struct {
+    // Path relative to the package, e.g. "files/check.cpp".
+    Path    string
+    // Polygon source type, e.g. "cpp.g++17".
+    Type    string
+    Code    string
+}
+
+// A test group of a Polygon package.
+type PolygonGroup struct {
+    Name            string
+    Points          int
+    // "each-test" or "complete-group".
+    PointsPolicy    string
+    // Names of groups which must pass first. Not enforced by the
+    // engine, which judges every group; check them when scoring.
+    Dependencies    []string
+    // Indices of tests, starting from 1.
+    Tests           []int
+}
+
+// A problem loaded from a Polygon package.
+type PolygonPackage struct {
+    // Tests, limits and groups, judged leniently until
+    // a checker is added with [Engine.AddPolygonChecker].
+    Problem     *Problem
+    ShortName   string
+    // Groups as described by the package, nil if there are none.
+    Groups      []PolygonGroup
+    // May be nil, in which case outputs are compared leniently.
+    Checker     *PolygonSource
+    // Interactive problems can't be judged, the source is only loaded.
+    Interactor  *PolygonSource
+    Validators  []PolygonSource
+    // Resource files, e.g. testlib.h.
+    Resources   []PolygonSource
+}
+
+type polygonSourceXML struct {
+    Path    string  `xml:"path,attr"`
+    Type    string  `xml:"type,attr"`
+}
+
+type polygonXML struct {
+    ShortName   string  `xml:"short-name,attr"`
+    Names       []struct {
+        Language    string  `xml:"language,attr"`
+        Value       string  `xml:"value,attr"`
+    } `xml:"names>name"`
+    Judging     struct {
+        InputFile   string  `xml:"input-file,attr"`
+        OutputFile  string  `xml:"output-file,attr"`
+        Testsets    []polygonTestsetXML `xml:"testset"`
+    } `xml:"judging"`
+    Resources   []polygonSourceXML  `xml:"files>resources>file"`
+    Checker     *struct {
+        Source  *polygonSourceXML   `xml:"source"`
+    } `xml:"assets>checker"`
+    Interactor  *struct {
+        Source  *polygonSourceXML   `xml:"source"`
+    } `xml:"assets>interactor"`
+    Validators  []polygonSourceXML  `xml:"assets>validators>validator>source"`
+}
+
+type polygonTestsetXML struct {
+    Name        string  `xml:"name,attr"`
+    // Milliseconds.
+    TimeLimit   uint64  `xml:"time-limit"`
+    // Bytes.
+    MemoryLimit uint64  `xml:"memory-limit"`
+    TestCount   int     `xml:"test-count"`
+    InputPath   string  `xml:"input-path-pattern"`
+    AnswerPath  string  `xml:"answer-path-pattern"`
+    Tests       []struct {
+        Points  float64 `xml:"points,attr"`
+        Group   string  `xml:"group,attr"`
+    } `xml:"tests>test"`
+    Groups      []struct {
+        Name            string      `xml:"name,attr"`
+        Points          float64     `xml:"points,attr"`
+        PointsPolicy    string      `xml:"points-policy,attr"`
+        Dependencies    []struct {
+            Group   string  `xml:"group,attr"`
+        } `xml:"dependencies>dependency"`
+    } `xml:"groups>group"`
+}
+
+// Loads a Polygon package from a directory or a zip file.
+// Only full packages, which contain generated tests and answers, can be loaded.
+func LoadPolygon(name string) (*PolygonPackage, error) {
+    info, err := os.Stat(name)
+    if err != nil {
+        return nil, err
+    }
+    var fsys fs.FS
+    if info.IsDir() {
+        fsys = os.DirFS(name)
+    } else {
+        reader, err := zip.OpenReader(name)
+        if err != nil {
+            return nil, err
+        }
+        defer reader.Close()
+        if fsys, err = unwrapFolder(reader); err != nil {
+            return nil, err
+        }
+    }
+    p, err := LoadPolygonFS(fsys)
+    if err != nil {
+        return nil, fmt.Errorf("load polygon package %s: %w", name, err)
+    }
+    return p, nil
+}
+
+// Loads a Polygon package from a file system.
+func LoadPolygonFS(fsys fs.FS) (*PolygonPackage, error) {
+    data, err := fs.ReadFile(fsys, "problem.xml")
+    if err != nil {
+        return nil, err
+    }
+    var manifest polygonXML
+    if err := xml.Unmarshal(data, &manifest); err != nil {
+        return nil, fmt.Errorf("problem.xml: %w", err)
+    }
+    if manifest.Judging.InputFile != "" || manifest.Judging.OutputFile != "" {
+        return nil, errors.New("only standard input and output are supported")
+    }
+    testset, err := manifest.testset()
+    if err != nil {
+        return nil, err
+    }
+    p := &PolygonPackage{
+        Problem: &Problem{ Name: manifest.ShortName },
+        ShortName: manifest.ShortName,
+    }
+    // Prefers the english name.
+    for i, name := range manifest.Names {
+        if i == 0 || name.Language == "english" {
+            p.Problem.Name = name.Value
+        }
+        if name.Language == "english" {
+            break
+        }
+    }
+    if err := p.loadTests(fsys, testset); err != nil {
+        return nil, err
+    }
+    if p.Resources, err = readPolygonSources(fsys, manifest.Resources); err != nil {
+        return nil, err
+    }
+    if p.Validators, err = readPolygonSources(fsys, manifest.Validators); err != nil {
+        return nil, err
+    }
+    if manifest.Checker != nil {
+        if manifest.Checker.Source == nil {
+            return nil, errors.New("checker has no source")
+        }
+        if p.Checker, err = readPolygonSource(fsys, *manifest.Checker.Source); err != nil {
+            return nil, err
+        }
+    }
+    if manifest.Interactor != nil && manifest.Interactor.Source != nil {
+        if p.Interactor, err = readPolygonSource(fsys, *manifest.Interactor.Source); err != nil {
+            return nil, err
+        }
+    }
+    return p, nil
+}
+
+// Picks the testset named "tests", or the first one.
+func (m *polygonXML) testset() (*polygonTestsetXML, error) {
+    if len(m.Judging.Testsets) == 0 {
+        return nil, errors.New("no testset")
+    }
+    for i := range m.Judging.Testsets {
+        if m.Judging.Testsets[i].Name == "tests" {
+            return &m.Judging.Testsets[i], nil
+        }
+    }
+    return &m.Judging.Testsets[0], nil
+}
+
+func (p *PolygonPackage) loadTests(fsys fs.FS, testset *polygonTestsetXML) error {
+    count := max(testset.TestCount, len(testset.Tests))
+    if count == 0 {
+        return errors.New("no tests")
+    }
+    if testset.InputPath == "" || testset.AnswerPath == "" {
+        return fmt.Errorf("testset %s has no path patterns", testset.Name)
+    }
+    limits := Limits{
+        Time: testset.TimeLimit * 1000,
+        // Polygon limits stack & heap together.
+        Memory: testset.MemoryLimit,
+    }
+    groups := map[string]int{}
+    for i := 1; i <= count; i++ {
+        input, err := fs.ReadFile(fsys, fmt.Sprintf(testset.InputPath, i))
+        if errors.Is(err, fs.ErrNotExist) {
+            return fmt.Errorf("test %d is missing, generated tests require a full package", i)
+        }
+        if err != nil {
+            return err
+        }
+        answer, err := fs.ReadFile(fsys, fmt.Sprintf(testset.AnswerPath, i))
+        if errors.Is(err, fs.ErrNotExist) {
+            return fmt.Errorf("answer of test %d is missing, answers require a full package", i)
+        }
+        if err != nil {
+            return err
+        }
+        c := Case{
+            Stdin: string(input),
+            Stdout: string(answer),
+            Limits: limits,
+        }
+        group := ""
+        if i <= len(testset.Tests) {
+            c.Points = int(math.Round(testset.Tests[i-1].Points))
+            group = testset.Tests[i-1].Group
+        }
+        p.Problem.Tests = append(p.Problem.Tests, strconv.Itoa(i))
+        p.Problem.Cases = append(p.Problem.Cases, c)
+        if group == "" {
+            continue
+        }
+        g, ok := groups[group]
+        if !ok {
+            g = len(p.Groups)
+            groups[group] = g
+            p.Groups = append(p.Groups, PolygonGroup{ Name: group, PointsPolicy: "each-test" })
+        }
+        p.Groups[g].Tests = append(p.Groups[g].Tests, i)
+    }
+    for _, group := range testset.Groups {
+        g, ok := groups[group.Name]
+        if !ok {
+            continue
+        }
+        p.Groups[g].Points = int(math.Round(group.Points))
+        if group.PointsPolicy != "" {
+            p.Groups[g].PointsPolicy = group.PointsPolicy
+        }
+        for _, dependency := range group.Dependencies {
+            p.Groups[g].Dependencies = append(p.Groups[g].Dependencies, dependency.Group)
+        }
+    }
+    if p.Groups == nil {
+        return nil
+    }
+    // Every case must belong to a group to be run,
+    // so ungrouped tests are run on their own.
+    grouped := make([]bool, count+1)
+    for _, group := range p.Groups {
+        tests := group.Tests
+        for _, i := range tests {
+            grouped[i] = true
+        }
+        if group.PointsPolicy != "complete-group" {
+            // Tests are scored independently, a failure must not skip the rest.
+            for _, i := range tests {
+                p.Problem.Groups = append(p.Problem.Groups, []int{ i })
+            }
+            continue
+        }
+        // The rest of a group is skipped once a test fails,
+        // so points of a complete group are given by its last test.
+        p.Problem.Groups = append(p.Problem.Groups, tests)
+        p.Problem.SkipGroups = true
+        points := group.Points
+        for _, i := range tests {
+            if group.Points == 0 {
+                points += p.Problem.Cases[i-1].Points
+            }
+            p.Problem.Cases[i-1].Points = 0
+        }
+        p.Problem.Cases[tests[len(tests)-1]-1].Points = points
+    }
+    for i := 1; i <= count; i++ {
+        if !grouped[i] {
+            p.Problem.Groups = append(p.Problem.Groups, []int{ i })
+        }
+    }
+    return nil
+}
+
+func readPolygonSource(fsys fs.FS, source polygonSourceXML) (*PolygonSource, error) {
+    code, err := fs.ReadFile(fsys, source.Path)
+    if err != nil {
+        return nil, err
+    }
+    return &PolygonSource{ Path: source.Path, Type: source.Type, Code: string(code) }, nil
+}
+
+func readPolygonSources(fsys fs.FS, sources []polygonSourceXML) ([]PolygonSource, error) {
+    var result []PolygonSource
+    for _, source := range sources {
+        s, err := readPolygonSource(fsys, source)
+        if err != nil {
+            return nil, err
+        }
+        result = append(result, *s)
+    }
+    return result, nil
+}
+
+// Compiles the checker of given package in dir with the compiler of its
+// language, see [PolygonLanguages], and adds it as a [TestlibChecker].
+// Resources such as testlib.h are written to dir first, dir must be
+// kept as long as the engine. The package's problem is updated to use
+// the checker; nothing is done if the package has no checker.
+//
+// Like [Engine.AddJudger], must be called before spawning workers.
+func (e *Engine) AddPolygonChecker(ctx context.Context, p *PolygonPackage, dir string) error {
+    if p.Interactor != nil {
+        return errors.New("interactive problems are not supported")
+    }
+    if p.Checker == nil {
+        return nil
+    }
+    lang, ok := PolygonLanguages[strings.Split(p.Checker.Type, ".")[0]]
+    if !ok {
+        return fmt.Errorf("unknown checker type %q", p.Checker.Type)
+    }
+    compiler, ok := e.compilers[lang]
+    if !ok {
+        return fmt.Errorf("no compiler for checker language %q", lang)
+    }
+    dir, err := filepath.Abs(dir)
+    if err != nil {
+        return err
+    }
+    if err := os.MkdirAll(dir, 0o777); err != nil {
+        return systemError(EC_MKDIR, "create checker folder", err)
+    }
+    for _, resource := range p.Resources {
+        err := os.WriteFile(filepath.Join(dir, path.Base(resource.Path)), []byte(resource.Code), 0o666)
+        if err != nil {
+            return systemError(EC_WRITE_FILE, "write checker resource", err)
+        }
+    }
+    output := compiler.CompileContext(ctx, p.Checker.Code, dir)
+    if output.Err != nil {
+        return output.Err
+    }
+    if output.Status != ST_COMPILATION_SUCCESS {
+        return fmt.Errorf("compile checker %s: %s\n%s", p.Checker.Path, output.Status, output.Log)
+    }
+    p.Problem.Judger = NewTestlibChecker(output.Executable)
+    e.AddProblemJudger(p.Problem)
+    return nil
+}
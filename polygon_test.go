@@ -0,0 +1,94 @@
+package isfj
+
+import (
+    "context"
+    "slices"
+    "testing"
+    "testing/fstest"
+    "time"
+)
+
+const testPolygonXML = `<problem short-name="a-plus-b">
+  <judging>
+    <testset name="tests">
+      <time-limit>1000</time-limit>
+      <memory-limit>268435456</memory-limit>
+      <test-count>5</test-count>
+      <input-path-pattern>tests/%02d</input-path-pattern>
+      <answer-path-pattern>tests/%02d.a</answer-path-pattern>
+      <tests>
+        <test group="0" points="0"/>
+        <test group="1" points="10"/>
+        <test group="1" points="10"/>
+        <test group="2" points="5"/>
+        <test group="2" points="5"/>
+      </tests>
+      <groups>
+        <group name="0" points-policy="each-test"/>
+        <group name="1" points="30" points-policy="complete-group">
+          <dependencies><dependency group="0"/></dependencies>
+        </group>
+        <group name="2" points-policy="each-test"/>
+      </groups>
+    </testset>
+  </judging>
+</problem>`
+
+func testPolygonFS() fstest.MapFS {
+    fsys := fstest.MapFS{ "problem.xml": { Data: []byte(testPolygonXML) } }
+    for i, name := range []string{ "01", "02", "03", "04", "05" } {
+        answer := "1 2\n"
+        // the first test of each multi-test group fails
+        if i == 1 || i == 3 {
+            answer = "3\n"
+        }
+        fsys["tests/" + name] = &fstest.MapFile{ Data: []byte("1 2\n") }
+        fsys["tests/" + name + ".a"] = &fstest.MapFile{ Data: []byte(answer) }
+    }
+    return fsys
+}
+
+func TestPolygonGroups(t *testing.T) {
+    pkg, err := LoadPolygonFS(testPolygonFS())
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !slices.EqualFunc(pkg.Problem.Groups, [][]int{ { 1 }, { 2, 3 }, { 4 }, { 5 } }, slices.Equal) {
+        t.Errorf("unexpected job groups %v", pkg.Problem.Groups)
+    }
+    limits := Limits{ Time: 1000000, Memory: 268435456 }
+    if pkg.Problem.Cases[0].Limits != limits {
+        t.Errorf("expected limits %+v, got %+v", limits, pkg.Problem.Cases[0].Limits)
+    }
+    if !pkg.Problem.SkipGroups {
+        t.Error("complete group doesn't skip failed tests")
+    }
+    if !slices.Equal(pkg.Groups[1].Dependencies, []string{ "0" }) {
+        t.Errorf("unexpected dependencies %v", pkg.Groups[1].Dependencies)
+    }
+
+    e := newTestEngine(t)
+    if err := e.SpawnWorkers(1); err != nil {
+        t.Fatal(err)
+    }
+    ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+    defer cancel()
+    defer e.Shutdown(ctx)
+    task, err := e.Schedule(NewJob(pkg.Problem.JobInit(catScript, "sh")))
+    if err != nil {
+        t.Fatal(err)
+    }
+    final, err := task.Wait(ctx)
+    if err != nil {
+        t.Fatal(err)
+    }
+    // the complete group scores nothing, the each-test group keeps test 5
+    statuses := []Status{ ST_ACCEPTED, ST_WRONG_ANSWER, ST_SKIPPED, ST_WRONG_ANSWER, ST_ACCEPTED }
+    points := []int{ 0, 0, 0, 0, 5 }
+    for i := range statuses {
+        result := final.Results[i+1]
+        if result.Status != statuses[i] || result.Points != points[i] {
+            t.Errorf("test %d: expected %s with %d points, got %s with %d", i+1, statuses[i], points[i], result.Status, result.Points)
+        }
+    }
+}
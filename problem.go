@@ -0,0 +1,342 @@
+package isfj
+
+import (
+    "archive/zip"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io/fs"
+    "os"
+    "path"
+    "path/filepath"
+    "slices"
+    "strconv"
+    "strings"
+
+    "gopkg.in/yaml.v3"
+)
+
+// A test listed in a [ProblemManifest].
+type ProblemTest struct {
+    // Path of the input, relative to the problem.
+    Input   string      `json:"input" yaml:"input"`
+    // Path of the expected output, relative to the problem.
+    Output  string      `json:"output" yaml:"output"`
+    Args    []string    `json:"args" yaml:"args"`
+    // Overrides [ProblemManifest.Points] if set.
+    Points  *int        `json:"points" yaml:"points"`
+    // Overrides [ProblemManifest.Limits] if set.
+    Limits  *Limits     `json:"limits" yaml:"limits"`
+}
+
+// How outputs of a problem are checked. Judger ids only mean something
+// inside an [Engine], so special judgers are described instead.
+type ProblemChecker struct {
+    // J_LAX or J_STRICT, lax by default.
+    // Must be empty if a special judger is given.
+    Mode        string  `json:"mode" yaml:"mode"`
+    // Command template of an [ExternalJudger], run in the problem
+    // directory. Zip files can't ship such checkers, so they are rejected.
+    External    string  `json:"external" yaml:"external"`
+    // Path of a [LuaJudger] script, relative to the problem.
+    Lua         string  `json:"lua" yaml:"lua"`
+}
+
+// Describes a problem, read from problem.json,
+// problem.yaml or problem.yml. Every field is optional.
+type ProblemManifest struct {
+    Name    string          `json:"name" yaml:"name"`
+    // Limits of every test.
+    Limits  Limits          `json:"limits" yaml:"limits"`
+    // Points of every test.
+    Points  int             `json:"points" yaml:"points"`
+    // Tests in order. Empty means every <name>.in with a matching
+    // <name>.out or <name>.ans, sorted by name (numerically if possible).
+    Tests   []ProblemTest   `json:"tests" yaml:"tests"`
+    // Groups of test indices, starting from 1, see [Job.Groups].
+    Groups  [][]int         `json:"groups" yaml:"groups"`
+    // How outputs are checked, lax by default.
+    Checker ProblemChecker  `json:"checker" yaml:"checker"`
+    // Path of the needle. Relative paths are resolved against
+    // the problem directory, or the folder containing the zip.
+    Needle  string          `json:"needle" yaml:"needle"`
+}
+
+// Names of manifest files, in order of preference.
+var manifestNames = []string{ "problem.json", "problem.yaml", "problem.yml" }
+
+// A problem with its tests loaded.
+type Problem struct {
+    Name    string
+    // Name of each test, e.g. "1" for 1.in & 1.out.
+    Tests   []string
+    Cases   []Case
+    Groups  [][]int
+    // See [JobInit.SkipGroups].
+    SkipGroups  bool
+    // Set by [Engine.AddProblemJudger] if Judger is not nil.
+    Mode    JudgeMode
+    // Special judger given by the manifest, nil if none.
+    Judger  SpecialJudger
+    // Absolute path of the needle, may be empty.
+    Needle  string
+}
+
+// Loads a problem from a directory or a zip file.
+// A zip file whose only entry is a folder is loaded from that folder.
+func LoadProblem(name string) (*Problem, error) {
+    info, err := os.Stat(name)
+    if err != nil {
+        return nil, err
+    }
+    var fsys fs.FS
+    base := name
+    if info.IsDir() {
+        fsys = os.DirFS(name)
+    } else {
+        reader, err := zip.OpenReader(name)
+        if err != nil {
+            return nil, err
+        }
+        defer reader.Close()
+        if fsys, err = unwrapFolder(reader); err != nil {
+            return nil, err
+        }
+        base = filepath.Dir(name)
+    }
+    base, err = filepath.Abs(base)
+    if err != nil {
+        return nil, err
+    }
+    p, err := LoadProblemFS(fsys, base)
+    if err != nil {
+        return nil, fmt.Errorf("load problem %s: %w", name, err)
+    }
+    if _, ok := p.Judger.(*ExternalJudger); ok && !info.IsDir() {
+        // Files inside the zip can't be found by the command.
+        return nil, fmt.Errorf("load problem %s: checker: external checkers can't be run from a zip file, extract it first", name)
+    }
+    return p, nil
+}
+
+// Descends into the only folder of fsys, if any.
+func unwrapFolder(fsys fs.FS) (fs.FS, error) {
+    entries, err := fs.ReadDir(fsys, ".")
+    if err != nil {
+        return nil, err
+    }
+    if len(entries) == 1 && entries[0].IsDir() {
+        return fs.Sub(fsys, entries[0].Name())
+    }
+    return fsys, nil
+}
+
+// Reads the manifest of a problem, the zero value if there is none.
+func readManifest(fsys fs.FS) (ProblemManifest, error) {
+    var manifest ProblemManifest
+    for _, name := range manifestNames {
+        data, err := fs.ReadFile(fsys, name)
+        if errors.Is(err, fs.ErrNotExist) {
+            continue
+        }
+        if err != nil {
+            return manifest, err
+        }
+        if path.Ext(name) == ".json" {
+            err = json.Unmarshal(data, &manifest)
+        } else {
+            err = yaml.Unmarshal(data, &manifest)
+        }
+        if err != nil {
+            return manifest, fmt.Errorf("%s: %w", name, err)
+        }
+        return manifest, nil
+    }
+    return manifest, nil
+}
+
+// Finds pairs of <name>.in & <name>.out (or <name>.ans) in dir.
+// Numeric names are sorted by value, others by name.
+func findTests(fsys fs.FS, dir string) ([]ProblemTest, []string, error) {
+    inputs, err := fs.Glob(fsys, path.Join(dir, "*.in"))
+    if err != nil {
+        return nil, nil, err
+    }
+    slices.SortFunc(inputs, func(a, b string) int {
+        a, b = strings.TrimSuffix(path.Base(a), ".in"), strings.TrimSuffix(path.Base(b), ".in")
+        x, errA := strconv.Atoi(a)
+        y, errB := strconv.Atoi(b)
+        if errA == nil && errB == nil {
+            return x - y
+        }
+        return strings.Compare(a, b)
+    })
+    tests := make([]ProblemTest, 0, len(inputs))
+    names := make([]string, 0, len(inputs))
+    for _, input := range inputs {
+        name := strings.TrimSuffix(input, ".in")
+        test := ProblemTest{ Input: input }
+        for _, ext := range []string{ ".out", ".ans" } {
+            if _, err := fs.Stat(fsys, name + ext); err == nil {
+                test.Output = name + ext
+                break
+            }
+        }
+        if test.Output == "" {
+            return nil, nil, fmt.Errorf("no output for %s", input)
+        }
+        tests = append(tests, test)
+        names = append(names, path.Base(name))
+    }
+    return tests, names, nil
+}
+
+// Loads a problem from a file system.
+// Relative needle paths are resolved against base,
+// and external checkers are run in it.
+func LoadProblemFS(fsys fs.FS, base string) (*Problem, error) {
+    manifest, err := readManifest(fsys)
+    if err != nil {
+        return nil, err
+    }
+    tests := manifest.Tests
+    var names []string
+    if len(tests) == 0 {
+        if tests, names, err = findTests(fsys, "."); err != nil {
+            return nil, err
+        }
+    } else {
+        for _, test := range tests {
+            names = append(names, strings.TrimSuffix(path.Base(test.Input), path.Ext(test.Input)))
+        }
+    }
+    if len(tests) == 0 {
+        return nil, errors.New("no tests")
+    }
+    p := &Problem{
+        Name: manifest.Name,
+        Tests: names,
+        Groups: manifest.Groups,
+        Needle: manifest.Needle,
+    }
+    if err := p.loadChecker(fsys, base, manifest.Checker); err != nil {
+        return nil, fmt.Errorf("checker: %w", err)
+    }
+    if p.Needle != "" && !filepath.IsAbs(p.Needle) {
+        p.Needle = filepath.Join(base, p.Needle)
+    }
+    for _, test := range tests {
+        input, err := fs.ReadFile(fsys, test.Input)
+        if err != nil {
+            return nil, err
+        }
+        output, err := fs.ReadFile(fsys, test.Output)
+        if err != nil {
+            return nil, err
+        }
+        c := Case{
+            Stdin: string(input),
+            Stdout: string(output),
+            Args: test.Args,
+            Limits: manifest.Limits,
+            Points: manifest.Points,
+        }
+        if test.Limits != nil {
+            c.Limits = *test.Limits
+        }
+        if test.Points != nil {
+            c.Points = *test.Points
+        }
+        p.Cases = append(p.Cases, c)
+    }
+    if err := p.fillGroups(); err != nil {
+        return nil, fmt.Errorf("groups: %w", err)
+    }
+    return p, nil
+}
+
+// Checks group indices, and puts every ungrouped test in a group
+// of its own, since only grouped tests are run.
+func (p *Problem) fillGroups() error {
+    if p.Groups == nil {
+        return nil
+    }
+    grouped := make([]bool, len(p.Cases)+1)
+    for g, group := range p.Groups {
+        for _, i := range group {
+            if i < 1 || i > len(p.Cases) {
+                return fmt.Errorf("group %d refers to test %d, expected 1~%d", g+1, i, len(p.Cases))
+            }
+            grouped[i] = true
+        }
+    }
+    for i := 1; i <= len(p.Cases); i++ {
+        if !grouped[i] {
+            p.Groups = append(p.Groups, []int{ i })
+        }
+    }
+    return nil
+}
+
+// Sets the mode or creates the special judger described by checker.
+func (p *Problem) loadChecker(fsys fs.FS, base string, checker ProblemChecker) error {
+    if checker.External != "" && checker.Lua != "" {
+        return errors.New("at most one of external & lua may be set")
+    }
+    if checker.External == "" && checker.Lua == "" {
+        switch checker.Mode {
+            case "", J_LAX.Ident():
+                p.Mode = J_LAX
+            case J_STRICT.Ident():
+                p.Mode = J_STRICT
+            default:
+                return fmt.Errorf("unknown mode %q, expected J_LAX or J_STRICT, or a special judger by external or lua", checker.Mode)
+        }
+        return nil
+    }
+    if checker.Mode != "" {
+        return errors.New("mode must be empty when a special judger is given")
+    }
+    if checker.External != "" {
+        judger, err := NewExternalJudger(checker.External)
+        if err != nil {
+            return err
+        }
+        judger.Dir = base
+        p.Judger = judger
+        return nil
+    }
+    code, err := fs.ReadFile(fsys, checker.Lua)
+    if err != nil {
+        return err
+    }
+    judger, err := NewLuaJudger(string(code))
+    if err != nil {
+        return err
+    }
+    p.Judger = judger
+    return nil
+}
+
+// Adds the special judger of given problem, if any,
+// and makes the problem use it.
+// Like [Engine.AddJudger], must be called before spawning workers.
+func (e *Engine) AddProblemJudger(p *Problem) {
+    if p.Judger != nil {
+        p.Mode = MakeSpecialJudgeMode(e.AddJudger(p.Judger))
+    }
+}
+
+// Creates the arguments for judging given code against this problem.
+func (p *Problem) JobInit(code, lang string) JobInit {
+    job := Job{ Cases: p.Cases, Groups: p.Groups }.Clone()
+    return JobInit{
+        Code: code,
+        Lang: lang,
+        Needle: p.Needle,
+        Mode: p.Mode,
+        Cases: job.Cases,
+        Groups: job.Groups,
+        SkipGroups: p.SkipGroups,
+    }
+}
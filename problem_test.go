@@ -0,0 +1,125 @@
+package isfj
+
+import (
+    "archive/zip"
+    "os"
+    "path/filepath"
+    "slices"
+    "strings"
+    "testing"
+    "testing/fstest"
+)
+
+func testProblemFS(manifest string) fstest.MapFS {
+    return fstest.MapFS{
+        "problem.yaml": { Data: []byte(manifest) },
+        "1.in": { Data: []byte("1 2\n") },
+        "1.out": { Data: []byte("3\n") },
+        "check.lua": { Data: []byte("function judge(got, expected) return true end\n") },
+    }
+}
+
+func TestProblemCheckerModes(t *testing.T) {
+    for manifest, mode := range map[string]JudgeMode{
+        "name: a": J_LAX,
+        "checker: { mode: J_LAX }": J_LAX,
+        "checker: { mode: J_STRICT }": J_STRICT,
+    } {
+        p, err := LoadProblemFS(testProblemFS(manifest), "/problems/a")
+        if err != nil {
+            t.Fatalf("%s: %v", manifest, err)
+        }
+        if p.Mode != mode || p.Judger != nil {
+            t.Errorf("%s: expected %s without judger, got %s, %v", manifest, mode, p.Mode, p.Judger)
+        }
+    }
+}
+
+func TestProblemSpecialChecker(t *testing.T) {
+    p, err := LoadProblemFS(testProblemFS("checker: { lua: check.lua }"), "/problems/a")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if _, ok := p.Judger.(*LuaJudger); !ok {
+        t.Fatalf("expected a Lua judger, got %v", p.Judger)
+    }
+    p, err = LoadProblemFS(testProblemFS("checker: { external: 'diff {{ .Got }} {{ .Expected }}' }"), "/problems/a")
+    if err != nil {
+        t.Fatal(err)
+    }
+    judger, ok := p.Judger.(*ExternalJudger)
+    if !ok || judger.Dir != "/problems/a" {
+        t.Fatalf("expected an external judger run in /problems/a, got %v", p.Judger)
+    }
+
+    e := NewEngine(t.TempDir())
+    other, err := NewExternalJudger("true")
+    if err != nil {
+        t.Fatal(err)
+    }
+    e.AddJudger(other)
+    e.AddProblemJudger(p)
+    if p.Mode.ModeBits() != J_SPECIAL || p.Mode.JudgerId() != 1 {
+        t.Errorf("expected the second special judger, got %s", p.Mode)
+    }
+    if p.JobInit("", "c").Mode != p.Mode {
+        t.Error("job doesn't use the problem's judger")
+    }
+}
+
+func TestProblemCheckerRejected(t *testing.T) {
+    for _, manifest := range []string{
+        "checker: { mode: J_SPECIAL }",
+        "checker: { mode: J_STRICT, lua: check.lua }",
+        "checker: { lua: check.lua, external: diff }",
+        "checker: { lua: missing.lua }",
+    } {
+        if _, err := LoadProblemFS(testProblemFS(manifest), "/problems/a"); err == nil || !strings.Contains(err.Error(), "checker") {
+            t.Errorf("%s: loaded with %v", manifest, err)
+        }
+    }
+}
+
+func TestProblemGroups(t *testing.T) {
+    fsys := testProblemFS("groups: [[2, 3]]")
+    fsys["2.in"], fsys["2.out"] = fsys["1.in"], fsys["1.out"]
+    fsys["3.in"], fsys["3.out"] = fsys["1.in"], fsys["1.out"]
+    p, err := LoadProblemFS(fsys, "/problems/a")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !slices.EqualFunc(p.Groups, [][]int{ { 2, 3 }, { 1 } }, slices.Equal) {
+        t.Errorf("ungrouped test not run on its own: %v", p.Groups)
+    }
+    if err := NewJob(p.JobInit(catScript, "sh")).Validate(); err != nil {
+        t.Error(err)
+    }
+    fsys = testProblemFS("groups: [[1, 2]]")
+    if _, err := LoadProblemFS(fsys, "/problems/a"); err == nil || !strings.Contains(err.Error(), "test 2") {
+        t.Errorf("group out of range loaded with %v", err)
+    }
+}
+
+func TestZipProblemExternalChecker(t *testing.T) {
+    name := filepath.Join(t.TempDir(), "a.zip")
+    file, err := os.Create(name)
+    if err != nil {
+        t.Fatal(err)
+    }
+    writer := zip.NewWriter(file)
+    for path, data := range testProblemFS("checker: { external: 'python3 check.py {{ .Got }}' }") {
+        w, err := writer.Create(path)
+        if err != nil {
+            t.Fatal(err)
+        }
+        w.Write(data.Data)
+    }
+    writer.Close()
+    file.Close()
+    if _, err := LoadProblem(name); err == nil || !strings.Contains(err.Error(), "zip") {
+        t.Errorf("external checker in a zip loaded with %v", err)
+    }
+    if _, err := LoadProblemFS(testProblemFS("checker: { external: 'python3 check.py {{ .Got }}' }"), "/problems/a"); err != nil {
+        t.Error(err)
+    }
+}
@@ -0,0 +1,278 @@
+package isfj
+
+import (
+    "context"
+    "maps"
+    "slices"
+)
+
+// Tasks waiting for a worker.
+//
+// Tasks with higher priorities are picked first.
+// With fair share enabled, among tasks of the same priority,
+// those whose queue has fewer running tasks are picked first.
+// Otherwise tasks are picked in FIFO order.
+type taskQueue struct {
+    tasks       []*Task
+    fairShare   bool
+    // Maximum running tasks of each queue.
+    limits      map[string]int
+    // Running tasks of each queue.
+    running     map[string]int
+}
+
+func (q *taskQueue) len() int {
+    return len(q.tasks)
+}
+
+func (q *taskQueue) push(t *Task) {
+    q.tasks = append(q.tasks, t)
+}
+
+func (q *taskQueue) before(a, b *Task, running map[string]int) bool {
+    if a.job.Priority != b.job.Priority {
+        return a.job.Priority > b.job.Priority
+    }
+    if q.fairShare && a.job.Queue != b.job.Queue {
+        return running[a.job.Queue] < running[b.job.Queue]
+    }
+    return false
+}
+
+// Index of the next task to pick, -1 if none can be picked.
+func (q *taskQueue) pick(running map[string]int, ignoreLimits bool) int {
+    best := -1
+    for i, t := range q.tasks {
+        limit := q.limits[t.job.Queue]
+        if !ignoreLimits && limit > 0 && running[t.job.Queue] >= limit {
+            continue
+        }
+        if best < 0 || q.before(t, q.tasks[best], running) {
+            best = i
+        }
+    }
+    return best
+}
+
+// Removes and returns the next task, or nil if none can be picked.
+// The task counts as running until [taskQueue.done] is called.
+func (q *taskQueue) pop() *Task {
+    index := q.pick(q.running, false)
+    if index < 0 {
+        return nil
+    }
+    t := q.tasks[index]
+    q.tasks = slices.Delete(q.tasks, index, index+1)
+    q.running[t.job.Queue]++
+    return t
+}
+
+func (q *taskQueue) done(t *Task) {
+    q.running[t.job.Queue]--
+    if q.running[t.job.Queue] <= 0 {
+        delete(q.running, t.job.Queue)
+    }
+}
+
+func (q *taskQueue) remove(id uint64) bool {
+    index := slices.IndexFunc(q.tasks, func(t *Task) bool { return t.id == id })
+    if index >= 0 {
+        q.tasks = slices.Delete(q.tasks, index, index+1)
+    }
+    return index >= 0
+}
+
+// Picks queued tasks on a copy of the queue, in the order they
+// would be picked if no running task finishes, until yield returns false.
+func (q *taskQueue) simulate(yield func(t *Task) bool) {
+    sim := taskQueue{
+        tasks: slices.Clone(q.tasks),
+        fairShare: q.fairShare,
+        running: maps.Clone(q.running),
+    }
+    for len(sim.tasks) > 0 {
+        index := sim.pick(sim.running, true)
+        t := sim.tasks[index]
+        sim.tasks = slices.Delete(sim.tasks, index, index+1)
+        sim.running[t.job.Queue]++
+        if !yield(t) {
+            return
+        }
+    }
+}
+
+// Ids of queued tasks, in the order they would be picked
+// if no running task finishes.
+func (q *taskQueue) ids() []uint64 {
+    ids := make([]uint64, 0, len(q.tasks))
+    q.simulate(func(t *Task) bool {
+        ids = append(ids, t.id)
+        return true
+    })
+    return ids
+}
+
+func (q *taskQueue) contains(id uint64) bool {
+    return slices.IndexFunc(q.tasks, func(t *Task) bool { return t.id == id }) >= 0
+}
+
+// Position of given task, -1 if not queued.
+func (q *taskQueue) index(id uint64) int {
+    if !q.contains(id) {
+        return -1
+    }
+    index := 0
+    q.simulate(func(t *Task) bool {
+        if t.id == id {
+            return false
+        }
+        index++
+        return true
+    })
+    return index
+}
+
+// Wakes up everyone waiting on the queue.
+// Must be called with e.lock held.
+func (e *Engine) notify() {
+    close(e.changed)
+    e.changed = make(chan any)
+    if e.metrics != nil {
+        e.metrics.QueueChanged(e.queue.len(), len(e.running))
+    }
+}
+
+// Sets the maximum number of tasks waiting for a worker.
+// 0 means unlimited, which is the default.
+func (e *Engine) SetQueueCapacity(n int) {
+    e.lock.Lock()
+    defer e.lock.Unlock()
+    e.capacity = n
+    e.notify()
+}
+
+// Enables or disables fair share between queues,
+// see [JobInit.Queue]. Disabled by default.
+func (e *Engine) SetFairShare(enabled bool) {
+    e.lock.Lock()
+    defer e.lock.Unlock()
+    e.queue.fairShare = enabled
+    e.notify()
+}
+
+// Sets the maximum number of workers running
+// tasks of given queue at the same time.
+// 0 means unlimited, which is the default.
+func (e *Engine) SetQueueLimit(queue string, n int) {
+    e.lock.Lock()
+    defer e.lock.Unlock()
+    if n > 0 {
+        e.queue.limits[queue] = n
+    } else {
+        delete(e.queue.limits, queue)
+    }
+    e.notify()
+}
+
+func (e *Engine) full() bool {
+    return e.capacity > 0 && e.queue.len() >= e.capacity
+}
+
+// Ids of tasks waiting for a worker,
+// in the order they will be picked up
+// if no running task finishes.
+func (e *Engine) QueuedTasks() []uint64 {
+    e.lock.Lock()
+    defer e.lock.Unlock()
+    return e.queue.ids()
+}
+
+// Position of given task in the queue, starting from 0.
+// Returns false if the task is not waiting for a worker.
+func (e *Engine) QueuePosition(id uint64) (int, bool) {
+    e.lock.Lock()
+    defer e.lock.Unlock()
+    index := e.queue.index(id)
+    return index, index >= 0
+}
+
+// Number of tasks waiting for a worker.
+func (e *Engine) QueueLength() int {
+    e.lock.Lock()
+    defer e.lock.Unlock()
+    return e.queue.len()
+}
+
+// Called by workers when a task from [Engine.next] is finished.
+func (e *Engine) done(t *Task) {
+    e.lock.Lock()
+    defer e.lock.Unlock()
+    e.queue.done(t)
+    delete(e.running, t.id)
+    e.notify()
+}
+
+// Blocks until a task is available for given worker.
+// Returns nil once the worker is retired, or the engine
+// is shutting down and the queue is drained.
+func (e *Engine) next(w *worker) *Task {
+    for {
+        e.lock.Lock()
+        if w.retired {
+            e.lock.Unlock()
+            return nil
+        }
+        if t := e.queue.pop(); t != nil {
+            e.running[t.id] = t
+            e.notify()
+            e.lock.Unlock()
+            return t
+        }
+        if e.stopping && e.queue.len() == 0 {
+            e.lock.Unlock()
+            return nil
+        }
+        changed := e.changed
+        e.lock.Unlock()
+        <-changed
+    }
+}
+
+func (e *Engine) enqueue(ctx context.Context, job Job, wait bool) (*Task, error) {
+    if err := e.Validate(job); err != nil {
+        return nil, err
+    }
+    e.lock.Lock()
+    for e.full() && !e.stopping {
+        if !wait {
+            e.lock.Unlock()
+            return nil, ErrQueueFull
+        }
+        changed := e.changed
+        e.lock.Unlock()
+        select {
+            case <-changed:
+            case <-ctx.Done(): {
+                return nil, ctx.Err()
+            }
+        }
+        e.lock.Lock()
+    }
+    if e.stopping {
+        e.lock.Unlock()
+        return nil, ErrEngineShutdown
+    }
+    t := e.newTask(e.counter, job)
+    e.counter++
+    saved := t.snapshot()
+    metrics := e.metrics
+    e.queue.push(t)
+    e.notify()
+    e.lock.Unlock()
+    if metrics != nil {
+        metrics.TaskScheduled(job.Queue)
+    }
+    // Newer states saved by a worker in the meantime are kept.
+    t.save(1, saved)
+    return t, nil
+}
@@ -0,0 +1,160 @@
+package isfj
+
+import (
+    "context"
+    "slices"
+    "time"
+)
+
+// How long finished tasks stay reachable by [Engine.GetTask],
+// see [Engine.SetRetention]. Zero values mean unlimited.
+type RetentionPolicy struct {
+    // Finished tasks expire this long after finishing.
+    MaxAge      time.Duration
+    // Only this many of the most recently finished tasks are kept.
+    MaxCount    int
+}
+
+// A read-only handle of a task, returned by [Engine.GetTask].
+// Unlike [*Task], it cannot be used to cancel the task.
+type TaskView struct {
+    task    *Task
+}
+
+// Id of the task.
+func (v TaskView) Id() uint64 {
+    return v.task.Id()
+}
+
+// See [Task.SnapJob].
+func (v TaskView) SnapJob() Job {
+    return v.task.SnapJob()
+}
+
+// See [Task.Subscribe].
+func (v TaskView) Subscribe(listener func(Event)) *Subscription {
+    return v.task.Subscribe(listener)
+}
+
+// See [Task.Done].
+func (v TaskView) Done() <-chan any {
+    return v.task.Done()
+}
+
+// See [Task.Wait].
+func (v TaskView) Wait(ctx context.Context) (Job, error) {
+    return v.task.Wait(ctx)
+}
+
+type finishedTask struct {
+    id      uint64
+    time    time.Time
+}
+
+// Looks up a scheduled task by id.
+// Finished tasks can only be looked up if a retention
+// policy is set, until they expire, see [Engine.SetRetention].
+func (e *Engine) GetTask(id uint64) (TaskView, bool) {
+    e.lock.Lock()
+    expired := e.expire(time.Now())
+    t, ok := e.tasks[id]
+    e.lock.Unlock()
+    e.forget(expired)
+    return TaskView{ task: t }, ok
+}
+
+// Sets how long finished tasks are kept.
+// Expired tasks are removed from the store as well, if any.
+// By default, finished tasks are dropped as soon as they finish,
+// and are only kept in the store.
+func (e *Engine) SetRetention(policy RetentionPolicy) {
+    e.lock.Lock()
+    e.retain = true
+    e.retention = policy
+    expired := e.expire(time.Now())
+    e.lock.Unlock()
+    e.forget(expired)
+}
+
+// Registers a task which finished before the engine started.
+// Must be called with e.lock held.
+func (e *Engine) restoreTask(id uint64, job Job) {
+    if !e.retain {
+        return
+    }
+    ctx, stop := context.WithCancel(context.Background())
+    stop()
+    t := &Task{
+        id: id,
+        job: job,
+        engine: e,
+        done: make(chan any),
+        ctx: ctx,
+        stop: stop,
+        trace: ctx,
+        span: noopSpan{},
+        finished: true,
+    }
+    close(t.done)
+    e.tasks[id] = t
+    index, _ := slices.BinarySearchFunc(e.finished, job.Updated, func(f finishedTask, t time.Time) int {
+        return f.time.Compare(t)
+    })
+    e.finished = slices.Insert(e.finished, index, finishedTask{ id: id, time: job.Updated })
+}
+
+// Called when a task finishes.
+func (e *Engine) retire(id uint64, finished time.Time) {
+    e.lock.Lock()
+    if !e.retain {
+        delete(e.tasks, id)
+        e.lock.Unlock()
+        return
+    }
+    e.finished = append(e.finished, finishedTask{ id: id, time: finished })
+    expired := e.expire(time.Now())
+    e.lock.Unlock()
+    e.forget(expired)
+}
+
+// Removes expired tasks from the registry, and returns their ids.
+// Must be called with e.lock held.
+func (e *Engine) expire(now time.Time) []uint64 {
+    n := 0
+    if e.retention.MaxAge > 0 {
+        for n < len(e.finished) && now.Sub(e.finished[n].time) > e.retention.MaxAge {
+            n++
+        }
+    }
+    if e.retention.MaxCount > 0 {
+        n = max(n, len(e.finished) - e.retention.MaxCount)
+    }
+    if n == 0 {
+        return nil
+    }
+    ids := make([]uint64, 0, n)
+    for _, f := range e.finished[:n] {
+        delete(e.tasks, f.id)
+        ids = append(ids, f.id)
+    }
+    e.finished = slices.Delete(e.finished, 0, n)
+    return ids
+}
+
+// Deletes expired tasks from the store.
+func (e *Engine) forget(ids []uint64) {
+    if len(ids) == 0 {
+        return
+    }
+    e.lock.Lock()
+    store := e.store
+    e.lock.Unlock()
+    if store == nil {
+        return
+    }
+    for _, id := range ids {
+        if err := store.Delete(id); err != nil {
+            e.reportError(id, systemError(EC_STORE, "delete job", err))
+        }
+    }
+}
@@ -2,6 +2,7 @@ package isfj
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"io"
 	"os"
@@ -19,24 +20,29 @@ import (
 // 0 means no limit.
 type Limits struct {
     // Time limit, in microseconds.
-    Time	        uint64
+    Time	        uint64  `json:"time" yaml:"time"`
     // Stack memory limit, in bytes.
-    StackMemory	    uint64
+    StackMemory	    uint64  `json:"stackMemory" yaml:"stackMemory"`
     // Heap memory limit, in bytes.
-    HeapMemory   uint64
+    HeapMemory   uint64     `json:"heapMemory" yaml:"heapMemory"`
+    // Stack + heap memory limit, in bytes.
+    Memory      uint64      `json:"memory" yaml:"memory"`
 }
 
 // Resource usages.
 type Usages struct {
     // Time of execution, in microseconds.
-    Time    uint64
+    Time    uint64  `json:"time" yaml:"time"`
     // Stack + heap memory, in bytes.
-    Memory  uint64
+    Memory  uint64  `json:"memory" yaml:"memory"`
+    // Core the program was pinned to.
+    // -1 if not pinned to a single core, or if the program never ran.
+    CPU     int     `json:"cpu" yaml:"cpu"`
 }
 
 // Checks if every limit is 0.
 func (u Limits) IsAllUnlimited() bool {
-    return u.Time == 0 && u.StackMemory == 0 && u.HeapMemory == 0
+    return u.Time == 0 && u.StackMemory == 0 && u.HeapMemory == 0 && u.Memory == 0
 }
 
 // Input to [Run].
@@ -51,6 +57,9 @@ type RunnerInput struct {
     Stdin		string
     // Resource limits.
     Limits		Limits
+    // Cores the program and its tracer may run on.
+    // Empty means any core.
+    CPUs		[]int
 }
 
 // Output from [Run].
@@ -70,6 +79,9 @@ type RunnerOutput struct {
     // If Status == [ST_RUNTIME_ERROR], this is the terminating signal.
     // If Status == [ST_HOSTILE_CODE], this is the resulting syscall.
     ExitInfo	int
+    // Cause of the failure, a [*SystemError].
+    // Only available if Status == [ST_SYSTEM_ERROR].
+    Err         error
 }
 
 type syscallInfo struct {
@@ -107,7 +119,10 @@ func vforkExec(executable string, args []string, env []string, stdin *os.File, s
             Ptrace: true,
         },
     })
-    return process.Pid, err
+    if err != nil {
+        return 0, err
+    }
+    return process.Pid, nil
 }
 
 func getMemoryUsages(pid int) (stack uint64, heap uint64, err error) {
@@ -134,8 +149,84 @@ func getMemoryUsages(pid int) (stack uint64, heap uint64, err error) {
     return
 }
 
+// Pins the current thread to given cores.
+// Returns a function restoring the previous affinity.
+// The thread must be locked.
+func pinThread(cpus []int) (func(), error) {
+    previous := unix.CPUSet{}
+    if err := unix.SchedGetaffinity(0, &previous); err != nil {
+        return nil, err
+    }
+    set := unix.CPUSet{}
+    for _, cpu := range cpus {
+        set.Set(cpu)
+    }
+    if err := unix.SchedSetaffinity(0, &set); err != nil {
+        return nil, err
+    }
+    return func() {
+        unix.SchedSetaffinity(0, &previous)
+    }, nil
+}
+
+// Kills the child once ctx is done.
+// Returns a function which stops watching.
+func killOnDone(ctx context.Context, pid int) func() {
+    if ctx.Done() == nil {
+        return func() {}
+    }
+    // pidfd prevents killing another process reusing the pid
+    pidfd, pidfdErr := unix.PidfdOpen(pid, 0)
+    stop := make(chan any)
+    done := make(chan any)
+    go func() {
+        defer close(done)
+        select {
+            case <-ctx.Done(): {
+                if pidfdErr == nil {
+                    unix.PidfdSendSignal(pidfd, unix.SIGKILL, nil, 0)
+                } else {
+                    unix.Kill(pid, unix.SIGKILL)
+                }
+            }
+            case <-stop:
+        }
+    }()
+    return func() {
+        close(stop)
+        <-done
+        if pidfdErr == nil {
+            unix.Close(pidfd)
+        }
+    }
+}
+
 // Runs given program.
 func Run(input RunnerInput) RunnerOutput {
+    return RunContext(context.Background(), input)
+}
+
+// Runs given program.
+// The program is killed once ctx is done, resulting in [ST_CANCELLED].
+func RunContext(ctx context.Context, input RunnerInput) RunnerOutput {
+    if ctx.Err() != nil {
+        return RunnerOutput{ Status: ST_CANCELLED, Usages: Usages{ CPU: -1 } }
+    }
+    output := run(ctx, input)
+    output.Usages.CPU = -1
+    if len(input.CPUs) == 1 && output.Err == nil {
+        output.Usages.CPU = input.CPUs[0]
+    }
+    if ctx.Err() != nil {
+        return RunnerOutput{
+            Status: ST_CANCELLED,
+            Usages: output.Usages,
+        }
+    }
+    return output
+}
+
+func run(ctx context.Context, input RunnerInput) RunnerOutput {
     stdinR, stdinW, err := os.Pipe()
     if err != nil {
         return RunnerOutput{
@@ -143,6 +234,7 @@ func Run(input RunnerInput) RunnerOutput {
             Stdout: "",
             Deduction: 0,
             ExitInfo: 0,
+            Err: systemError(EC_PIPE, "create stdin pipe", err),
         }
     }
     defer stdinR.Close()
@@ -155,6 +247,7 @@ func Run(input RunnerInput) RunnerOutput {
             Stdout: "",
             Deduction: 0,
             ExitInfo: 0,
+            Err: systemError(EC_PIPE, "create stdout pipe", err),
         }
     }
     defer stdoutR.Close()
@@ -166,6 +259,20 @@ func Run(input RunnerInput) RunnerOutput {
 
     runtime.LockOSThread()
     defer runtime.UnlockOSThread()
+    if len(input.CPUs) > 0 {
+        // the child inherits the affinity of this thread
+        restore, err := pinThread(input.CPUs)
+        if err != nil {
+            return RunnerOutput{
+                Status: ST_SYSTEM_ERROR,
+                Stdout: "",
+                Deduction: 0,
+                ExitInfo: 0,
+                Err: systemError(EC_AFFINITY, "set cpu affinity", err),
+            }
+        }
+        defer restore()
+    }
     pid, err := vforkExec(
         input.Executable, args, 
         []string { fmt.Sprintf("LD_PRELOAD=%s", input.NeedleLib) },
@@ -177,8 +284,10 @@ func Run(input RunnerInput) RunnerOutput {
             Stdout: "",
             Deduction: 0,
             ExitInfo: 0,
+            Err: systemError(EC_START_PROCESS, "start process", err),
         }
     }
+    defer killOnDone(ctx, pid)()
     var status unix.WaitStatus
     var usages Usages
     skipUsages := false
@@ -218,7 +327,8 @@ func Run(input RunnerInput) RunnerOutput {
                         }
                     } else if (
                         input.Limits.StackMemory > 0 && stack > input.Limits.StackMemory || 
-                        input.Limits.HeapMemory > 0 && heap > input.Limits.HeapMemory) {
+                        input.Limits.HeapMemory > 0 && heap > input.Limits.HeapMemory ||
+                        input.Limits.Memory > 0 && stack + heap > input.Limits.Memory) {
                         unix.Kill(pid, unix.SIGKILL)
                         return RunnerOutput{
                             Status: ST_MEMORY_LIMIT_EXCEEDED,
@@ -258,8 +368,10 @@ func Run(input RunnerInput) RunnerOutput {
                 return RunnerOutput{
                     Status: ST_SYSTEM_ERROR,
                     Stdout: "",
+                    Usages: usages,
                     Deduction: 0,
                     ExitInfo: 0,
+                    Err: systemError(EC_READ_OUTPUT, "read stdout", err),
                 }
             }
             return RunnerOutput{
@@ -0,0 +1,25 @@
+package isfj
+
+import (
+    "context"
+    "os"
+    "path/filepath"
+    "testing"
+)
+
+// The total limit applies to stack + heap, even if both are within theirs.
+func TestRunTotalMemoryLimit(t *testing.T) {
+    executable := filepath.Join(t.TempDir(), "sleep.sh")
+    if err := os.WriteFile(executable, []byte("#!/bin/sh\nsleep 1\n"), 0o755); err != nil {
+        t.Fatal(err)
+    }
+    input := RunnerInput{ Executable: executable, Limits: Limits{ StackMemory: 1 << 30, HeapMemory: 1 << 30 } }
+    output := RunContext(context.Background(), input)
+    if output.Status != ST_ACCEPTED {
+        t.Fatalf("expected %s, got %s: %v", ST_ACCEPTED, output.Status, output.Err)
+    }
+    input.Limits.Memory = output.Usages.Memory / 2
+    if output := RunContext(context.Background(), input); output.Status != ST_MEMORY_LIMIT_EXCEEDED {
+        t.Errorf("expected %s under %d bytes, got %s", ST_MEMORY_LIMIT_EXCEEDED, input.Limits.Memory, output.Status)
+    }
+}
@@ -0,0 +1,288 @@
+package isfj
+
+import (
+    "bufio"
+    "bytes"
+    "encoding/json"
+    "errors"
+    "io"
+    "maps"
+    "os"
+    "path/filepath"
+    "slices"
+    "sync"
+    "time"
+)
+
+// Persists jobs, so that tasks survive restarts.
+// See [Engine.SetStore] and [Engine.Recover].
+type TaskStore interface {
+    // Saves the current state of the job of a task.
+    Save(id uint64, job Job) error
+    // Removes a task from the store.
+    Delete(id uint64) error
+    // Loads the latest state of every saved task.
+    Load() (map[uint64]Job, error)
+}
+
+type storeRecord struct {
+    Id      uint64
+    Deleted bool    `json:",omitempty"`
+    Job     *Job    `json:",omitempty"`
+}
+
+// A [TaskStore] backed by an append-only log file.
+// Every save appends a line, so the latest state of each task
+// survives crashes. Use [FileStore.Compact] to drop old states.
+type FileStore struct {
+    path    string
+    file    *os.File
+    lock    sync.Mutex
+}
+
+// Opens or creates a log file at given path.
+// A partially written last line, e.g. after a crash, is removed.
+func OpenFileStore(path string) (*FileStore, error) {
+    file, err := os.OpenFile(path, os.O_CREATE | os.O_APPEND | os.O_RDWR, 0o666)
+    if err != nil {
+        return nil, err
+    }
+    if err := trimTornTail(file); err != nil {
+        file.Close()
+        return nil, err
+    }
+    return &FileStore{
+        path: path,
+        file: file,
+    }, nil
+}
+
+// Truncates the file after its last newline,
+// so that the next record starts on a line of its own.
+func trimTornTail(file *os.File) error {
+    info, err := file.Stat()
+    if err != nil {
+        return err
+    }
+    end := info.Size()
+    buf := make([]byte, 4096)
+    for end > 0 {
+        n := min(int64(len(buf)), end)
+        if _, err := file.ReadAt(buf[:n], end - n); err != nil {
+            return err
+        }
+        if i := bytes.LastIndexByte(buf[:n], '\n'); i >= 0 {
+            end += int64(i) + 1 - n
+            break
+        }
+        end -= n
+    }
+    if end == info.Size() {
+        return nil
+    }
+    return file.Truncate(end)
+}
+
+func (s *FileStore) append(record storeRecord) error {
+    line, err := json.Marshal(record)
+    if err != nil {
+        return err
+    }
+    s.lock.Lock()
+    defer s.lock.Unlock()
+    info, err := s.file.Stat()
+    if err != nil {
+        return err
+    }
+    if _, err := s.file.Write(append(line, '\n')); err != nil {
+        // don't leave a partial line for the next record to join
+        s.file.Truncate(info.Size())
+        return err
+    }
+    return s.file.Sync()
+}
+
+// Implements [TaskStore].
+func (s *FileStore) Save(id uint64, job Job) error {
+    return s.append(storeRecord{ Id: id, Job: &job })
+}
+
+// Implements [TaskStore].
+func (s *FileStore) Delete(id uint64) error {
+    return s.append(storeRecord{ Id: id, Deleted: true })
+}
+
+// Implements [TaskStore].
+// A partially written last line, e.g. after a crash, is ignored.
+func (s *FileStore) Load() (map[uint64]Job, error) {
+    s.lock.Lock()
+    defer s.lock.Unlock()
+    return s.load()
+}
+
+func (s *FileStore) load() (map[uint64]Job, error) {
+    file, err := os.Open(s.path)
+    if err != nil {
+        return nil, err
+    }
+    defer file.Close()
+    jobs := map[uint64]Job{}
+    reader := bufio.NewReader(file)
+    for {
+        line, err := reader.ReadBytes('\n')
+        if errors.Is(err, io.EOF) {
+            // no newline means the write was interrupted
+            return jobs, nil
+        }
+        if err != nil {
+            return nil, err
+        }
+        var record storeRecord
+        if err := json.Unmarshal(line, &record); err != nil {
+            return nil, err
+        }
+        if record.Deleted || record.Job == nil {
+            delete(jobs, record.Id)
+        } else {
+            jobs[record.Id] = *record.Job
+        }
+    }
+}
+
+// Rewrites the log, keeping only the latest state of each task.
+func (s *FileStore) Compact() error {
+    s.lock.Lock()
+    defer s.lock.Unlock()
+    jobs, err := s.load()
+    if err != nil {
+        return err
+    }
+    temp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path) + ".*")
+    if err != nil {
+        return err
+    }
+    defer os.Remove(temp.Name())
+    writer := bufio.NewWriter(temp)
+    ids := slices.Sorted(maps.Keys(jobs))
+    for _, id := range ids {
+        job := jobs[id]
+        line, err := json.Marshal(storeRecord{ Id: id, Job: &job })
+        if err != nil {
+            temp.Close()
+            return err
+        }
+        writer.Write(append(line, '\n'))
+    }
+    if err := writer.Flush(); err != nil {
+        temp.Close()
+        return err
+    }
+    if err := temp.Sync(); err != nil {
+        temp.Close()
+        return err
+    }
+    temp.Close()
+    if err := os.Rename(temp.Name(), s.path); err != nil {
+        return err
+    }
+    file, err := os.OpenFile(s.path, os.O_APPEND | os.O_WRONLY, 0o666)
+    if err != nil {
+        return err
+    }
+    s.file.Close()
+    s.file = file
+    return nil
+}
+
+// Closes the log file.
+func (s *FileStore) Close() error {
+    s.lock.Lock()
+    defer s.lock.Unlock()
+    return s.file.Close()
+}
+
+// Persists every scheduled task to given store.
+// Jobs are saved when scheduled, started and finished.
+// Failures to save are reported to [Engine.OnInternalError].
+func (e *Engine) SetStore(store TaskStore) {
+    e.lock.Lock()
+    defer e.lock.Unlock()
+    e.store = store
+}
+
+// Saves a job to the store, if any.
+// Must be called without holding e.lock.
+func (e *Engine) persist(id uint64, job Job) error {
+    e.lock.Lock()
+    store := e.store
+    e.lock.Unlock()
+    if store == nil {
+        return nil
+    }
+    if err := store.Save(id, job); err != nil {
+        return systemError(EC_STORE, "save job", err)
+    }
+    return nil
+}
+
+// Re-queues every unfinished task in the store, keeping their ids.
+// Should be called once on startup, after compilers and judgers are added.
+// Finished tasks can be looked up by [Engine.GetTask] until they expire,
+// if a retention policy is set before.
+//
+// Tasks which were running when the engine stopped are restarted
+// from scratch, with [Job.Restarts] incremented. Tasks which can
+// no longer be validated finish with [ST_SYSTEM_ERROR].
+func (e *Engine) Recover() ([]*Task, error) {
+    e.lock.Lock()
+    store := e.store
+    e.lock.Unlock()
+    if store == nil {
+        return nil, nil
+    }
+    jobs, err := store.Load()
+    if err != nil {
+        return nil, err
+    }
+    var tasks []*Task
+    for _, id := range slices.Sorted(maps.Keys(jobs)) {
+        job := jobs[id]
+        e.lock.Lock()
+        e.counter = max(e.counter, id + 1)
+        if job.Finished() {
+            e.restoreTask(id, job)
+            e.lock.Unlock()
+            continue
+        }
+        e.lock.Unlock()
+        if job.Status == ST_RUNNING {
+            job.Restarts++
+        }
+        job.Status = ST_WAITING
+        job.Results = newResults(len(job.Cases))
+        if err := e.Validate(job); err != nil {
+            job.Status = ST_SYSTEM_ERROR
+            job.Results[0].fail(err)
+            if err := e.persist(id, job); err != nil {
+                e.reportError(id, err)
+            }
+            e.lock.Lock()
+            e.restoreTask(id, job)
+            e.lock.Unlock()
+            continue
+        }
+        e.lock.Lock()
+        t := e.newTask(id, job)
+        saved := t.snapshot()
+        e.queue.push(t)
+        e.notify()
+        e.lock.Unlock()
+        t.save(1, saved)
+        tasks = append(tasks, t)
+    }
+    e.lock.Lock()
+    expired := e.expire(time.Now())
+    e.lock.Unlock()
+    e.forget(expired)
+    return tasks, nil
+}
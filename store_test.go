@@ -0,0 +1,180 @@
+package isfj
+
+import (
+    "context"
+    "errors"
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+)
+
+// Appends bytes as if a write was interrupted by a crash.
+func tearFileStore(t *testing.T, path string, torn string) {
+    t.Helper()
+    file, err := os.OpenFile(path, os.O_CREATE | os.O_APPEND | os.O_WRONLY, 0o666)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer file.Close()
+    if _, err := file.WriteString(torn); err != nil {
+        t.Fatal(err)
+    }
+}
+
+func TestFileStoreTornTail(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "tasks.log")
+    store, err := OpenFileStore(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := store.Save(1, NewJob(JobInit{ Code: "a", Lang: "c" })); err != nil {
+        t.Fatal(err)
+    }
+    store.Close()
+    tearFileStore(t, path, `{"Id":2,"Job":{"code":"b","la`)
+
+    store, err = OpenFileStore(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer store.Close()
+    if err := store.Save(3, NewJob(JobInit{ Code: "c", Lang: "c" })); err != nil {
+        t.Fatal(err)
+    }
+    jobs, err := store.Load()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(jobs) != 2 || jobs[1].Code != "a" || jobs[3].Code != "c" {
+        t.Fatalf("unexpected jobs after reopening a torn log: %v", jobs)
+    }
+}
+
+func TestFileStoreOnlyTornLine(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "tasks.log")
+    tearFileStore(t, path, `{"Id":1,"Jo`)
+    store, err := OpenFileStore(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer store.Close()
+    if err := store.Save(1, NewJob(JobInit{ Code: "a", Lang: "c" })); err != nil {
+        t.Fatal(err)
+    }
+    jobs, err := store.Load()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(jobs) != 1 || jobs[1].Code != "a" {
+        t.Fatalf("unexpected jobs after reopening a torn log: %v", jobs)
+    }
+}
+
+// A store failing every write.
+type failingStore struct{}
+
+func (failingStore) Save(id uint64, job Job) error {
+    return errors.New("disk full")
+}
+
+func (failingStore) Delete(id uint64) error {
+    return errors.New("disk full")
+}
+
+func (failingStore) Load() (map[uint64]Job, error) {
+    return nil, nil
+}
+
+// Store failures are reported without holding locks,
+// so the handler can look the task up.
+func TestStoreErrorHandlerLooksUpTask(t *testing.T) {
+    e := newTestEngine(t)
+    e.SetStore(failingStore{})
+    e.SetRetention(RetentionPolicy{ MaxCount: 1 })
+    reported := make(chan uint64, 100)
+    e.OnInternalError(func(id uint64, err error) {
+        if view, ok := e.GetTask(id); ok {
+            view.SnapJob()
+        }
+        reported <- id
+    })
+    if err := e.SpawnWorkers(1); err != nil {
+        t.Fatal(err)
+    }
+    ctx, cancel := context.WithTimeout(context.Background(), 10 * time.Second)
+    defer cancel()
+    defer e.Shutdown(ctx)
+    for i := 0; i < 3; i++ {
+        task, err := e.Schedule(newTestJob(1))
+        if err != nil {
+            t.Fatal(err)
+        }
+        if _, err := task.Wait(ctx); err != nil {
+            t.Fatal(err)
+        }
+    }
+    if len(reported) == 0 {
+        t.Error("store failures were not reported")
+    }
+}
+
+// Finished jobs are kept as they are by Recover, never judged again.
+func TestRecoverFinishedJob(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "tasks.log")
+    store, err := OpenFileStore(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    e := newTestEngine(t)
+    e.SetStore(store)
+    if err := e.SpawnWorkers(1); err != nil {
+        t.Fatal(err)
+    }
+    ctx, cancel := context.WithTimeout(context.Background(), 10 * time.Second)
+    defer cancel()
+    job := newTestJob(3)
+    job.Groups = [][]int{ { 2, 1 }, { 3 } }
+    task, err := e.Schedule(job)
+    if err != nil {
+        t.Fatal(err)
+    }
+    finished, err := task.Wait(ctx)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if finished.Status != ST_ACCEPTED {
+        t.Fatalf("expected %s, got %s", ST_ACCEPTED, finished.Status)
+    }
+    e.Shutdown(ctx)
+    store.Close()
+
+    store, err = OpenFileStore(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer store.Close()
+    e = newTestEngine(t)
+    e.SetStore(store)
+    e.SetRetention(RetentionPolicy{})
+    tasks, err := e.Recover()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(tasks) != 0 {
+        t.Fatalf("finished job re-queued as %d tasks", len(tasks))
+    }
+    view, ok := e.GetTask(task.Id())
+    if !ok {
+        t.Fatal("finished job not restored")
+    }
+    recovered := view.SnapJob()
+    if recovered.Status != ST_ACCEPTED || recovered.Restarts != 0 {
+        t.Errorf("recovered as %s with %d restarts", recovered.Status, recovered.Restarts)
+    }
+    for i, result := range recovered.Results[1:] {
+        if result.Status != ST_ACCEPTED || result.Points != 10 {
+            t.Errorf("case %d recovered as %s with %d points", i+1, result.Status, result.Points)
+        }
+    }
+}
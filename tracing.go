@@ -0,0 +1,269 @@
+package isfj
+
+import (
+    "bytes"
+    "context"
+    "crypto/rand"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "log/slog"
+    "net/http"
+    "strconv"
+    "sync"
+    "time"
+)
+
+// A timed operation in a trace, see [Tracer].
+type Span interface {
+    // Adds attributes to the span.
+    SetAttributes(attrs ...slog.Attr)
+    // Marks the span as failed.
+    RecordError(err error)
+    // Ends the span. Must be called exactly once.
+    End()
+}
+
+// Creates spans, see [Engine.SetTracer].
+// Each task produces a trace rooted at an "isfj.task" span,
+// with child spans "isfj.queue", "isfj.compile" and "isfj.case",
+// the latter containing "isfj.run" and "isfj.judge".
+type Tracer interface {
+    // Starts a span, which is a child of the span in ctx, if any.
+    // The returned context carries the new span.
+    Start(ctx context.Context, name string, attrs ...slog.Attr) (context.Context, Span)
+}
+
+type noopSpan struct {}
+
+func (noopSpan) SetAttributes(...slog.Attr) {}
+func (noopSpan) RecordError(error) {}
+func (noopSpan) End() {}
+
+type noopTracer struct {}
+
+func (noopTracer) Start(ctx context.Context, name string, attrs ...slog.Attr) (context.Context, Span) {
+    return ctx, noopSpan{}
+}
+
+// Sets the tracer of this engine.
+// Use [NewOTLPTracer] to export traces to a collector.
+// Nothing is traced by default.
+func (e *Engine) SetTracer(tracer Tracer) {
+    e.lock.Lock()
+    defer e.lock.Unlock()
+    e.tracer = tracer
+}
+
+func (e *Engine) getTracer() Tracer {
+    e.lock.Lock()
+    defer e.lock.Unlock()
+    if e.tracer == nil {
+        return noopTracer{}
+    }
+    return e.tracer
+}
+
+func (e *Engine) startSpan(parent context.Context, name string, attrs ...slog.Attr) (context.Context, Span) {
+    return e.getTracer().Start(parent, name, attrs...)
+}
+
+type otlpSpanKey struct {}
+
+type otlpSpan struct {
+    tracer      *OTLPTracer
+    traceId     [16]byte
+    spanId      [8]byte
+    parentId    [8]byte
+    root        bool
+    name        string
+    start       time.Time
+    lock        sync.Mutex
+    end         time.Time
+    attrs       []slog.Attr
+    err         error
+}
+
+func (s *otlpSpan) SetAttributes(attrs ...slog.Attr) {
+    s.lock.Lock()
+    defer s.lock.Unlock()
+    s.attrs = append(s.attrs, attrs...)
+}
+
+func (s *otlpSpan) RecordError(err error) {
+    if err == nil {
+        return
+    }
+    s.lock.Lock()
+    defer s.lock.Unlock()
+    s.err = err
+}
+
+func (s *otlpSpan) End() {
+    s.lock.Lock()
+    s.end = time.Now()
+    s.lock.Unlock()
+    s.tracer.finish(s)
+}
+
+// A [Tracer] which exports spans to an OpenTelemetry collector,
+// using OTLP/HTTP with JSON encoding.
+//
+// Spans are exported once the trace they belong to ends,
+// or when [OTLPTracer.Flush] is called.
+type OTLPTracer struct {
+    // URL of the traces endpoint,
+    // e.g. http://localhost:4318/v1/traces.
+    Endpoint    string
+    // Reported as the service.name resource attribute.
+    Service     string
+    // Client used for exporting, [http.DefaultClient] if nil.
+    Client      *http.Client
+    // Called when exporting in the background fails.
+    OnError     func(error)
+    lock        sync.Mutex
+    pending     []*otlpSpan
+}
+
+// Creates a tracer exporting to given endpoint.
+func NewOTLPTracer(endpoint string) *OTLPTracer {
+    return &OTLPTracer{
+        Endpoint: endpoint,
+        Service: "isfj",
+    }
+}
+
+// Implements [Tracer].
+func (t *OTLPTracer) Start(ctx context.Context, name string, attrs ...slog.Attr) (context.Context, Span) {
+    s := &otlpSpan{
+        tracer: t,
+        name: name,
+        start: time.Now(),
+        attrs: attrs,
+    }
+    rand.Read(s.spanId[:])
+    if parent, ok := ctx.Value(otlpSpanKey{}).(*otlpSpan); ok {
+        s.traceId = parent.traceId
+        s.parentId = parent.spanId
+    } else {
+        rand.Read(s.traceId[:])
+        s.root = true
+    }
+    return context.WithValue(ctx, otlpSpanKey{}, s), s
+}
+
+func (t *OTLPTracer) finish(s *otlpSpan) {
+    t.lock.Lock()
+    t.pending = append(t.pending, s)
+    t.lock.Unlock()
+    if !s.root {
+        return
+    }
+    go func() {
+        if err := t.Flush(context.Background()); err != nil && t.OnError != nil {
+            t.OnError(err)
+        }
+    }()
+}
+
+// Exports every ended span right away.
+// Should be called before the program exits.
+func (t *OTLPTracer) Flush(ctx context.Context) error {
+    t.lock.Lock()
+    spans := t.pending
+    t.pending = nil
+    t.lock.Unlock()
+    if len(spans) == 0 {
+        return nil
+    }
+    body, err := json.Marshal(t.encode(spans))
+    if err != nil {
+        return err
+    }
+    request, err := http.NewRequestWithContext(ctx, http.MethodPost, t.Endpoint, bytes.NewReader(body))
+    if err != nil {
+        return err
+    }
+    request.Header.Set("Content-Type", "application/json")
+    client := t.Client
+    if client == nil {
+        client = http.DefaultClient
+    }
+    response, err := client.Do(request)
+    if err != nil {
+        return err
+    }
+    response.Body.Close()
+    if response.StatusCode / 100 != 2 {
+        return fmt.Errorf("export spans: %s", response.Status)
+    }
+    return nil
+}
+
+// OTLP/JSON encoding of a trace export request.
+func (t *OTLPTracer) encode(spans []*otlpSpan) map[string]any {
+    encoded := make([]map[string]any, len(spans))
+    for i, s := range spans {
+        s.lock.Lock()
+        span := map[string]any{
+            "traceId": hex.EncodeToString(s.traceId[:]),
+            "spanId": hex.EncodeToString(s.spanId[:]),
+            "name": s.name,
+            // SPAN_KIND_INTERNAL
+            "kind": 1,
+            "startTimeUnixNano": strconv.FormatInt(s.start.UnixNano(), 10),
+            "endTimeUnixNano": strconv.FormatInt(s.end.UnixNano(), 10),
+            "attributes": encodeAttrs(s.attrs),
+        }
+        if !s.root {
+            span["parentSpanId"] = hex.EncodeToString(s.parentId[:])
+        }
+        if s.err != nil {
+            // STATUS_CODE_ERROR
+            span["status"] = map[string]any{ "code": 2, "message": s.err.Error() }
+        }
+        s.lock.Unlock()
+        encoded[i] = span
+    }
+    return map[string]any{
+        "resourceSpans": []any{
+            map[string]any{
+                "resource": map[string]any{
+                    "attributes": encodeAttrs([]slog.Attr{ slog.String("service.name", t.Service) }),
+                },
+                "scopeSpans": []any{
+                    map[string]any{
+                        "scope": map[string]any{ "name": "github.com/origamizyt/isfj" },
+                        "spans": encoded,
+                    },
+                },
+            },
+        },
+    }
+}
+
+func encodeAttrs(attrs []slog.Attr) []any {
+    encoded := make([]any, 0, len(attrs))
+    for _, attr := range attrs {
+        var value map[string]any
+        v := attr.Value.Resolve()
+        switch v.Kind() {
+            case slog.KindString:
+                value = map[string]any{ "stringValue": v.String() }
+            case slog.KindInt64:
+                value = map[string]any{ "intValue": strconv.FormatInt(v.Int64(), 10) }
+            case slog.KindUint64:
+                value = map[string]any{ "intValue": strconv.FormatUint(v.Uint64(), 10) }
+            case slog.KindDuration:
+                value = map[string]any{ "intValue": strconv.FormatInt(int64(v.Duration()), 10) }
+            case slog.KindFloat64:
+                value = map[string]any{ "doubleValue": v.Float64() }
+            case slog.KindBool:
+                value = map[string]any{ "boolValue": v.Bool() }
+            default:
+                value = map[string]any{ "stringValue": v.String() }
+        }
+        encoded = append(encoded, map[string]any{ "key": attr.Key, "value": value })
+    }
+    return encoded
+}
@@ -0,0 +1,142 @@
+package isfj
+
+import (
+    "context"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "slices"
+    "sync"
+    "testing"
+    "time"
+)
+
+type exportedSpan struct {
+    TraceId         string  `json:"traceId"`
+    SpanId          string  `json:"spanId"`
+    ParentSpanId    string  `json:"parentSpanId"`
+    Name            string  `json:"name"`
+}
+
+// A stand-in for an OpenTelemetry collector, keeping exported spans.
+type testCollector struct {
+    lock    sync.Mutex
+    spans   []exportedSpan
+}
+
+func (c *testCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    var request struct {
+        ResourceSpans []struct {
+            ScopeSpans []struct {
+                Spans []exportedSpan `json:"spans"`
+            } `json:"scopeSpans"`
+        } `json:"resourceSpans"`
+    }
+    if r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/json" {
+        http.Error(w, "unexpected request", http.StatusBadRequest)
+        return
+    }
+    if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    c.lock.Lock()
+    defer c.lock.Unlock()
+    for _, rs := range request.ResourceSpans {
+        for _, ss := range rs.ScopeSpans {
+            c.spans = append(c.spans, ss.Spans...)
+        }
+    }
+}
+
+func (c *testCollector) snapshot() []exportedSpan {
+    c.lock.Lock()
+    defer c.lock.Unlock()
+    return slices.Clone(c.spans)
+}
+
+// Names of the children of given span, sorted.
+func childNames(spans []exportedSpan, parent exportedSpan) []string {
+    var names []string
+    for _, s := range spans {
+        if s.ParentSpanId == parent.SpanId && s.TraceId == parent.TraceId {
+            names = append(names, s.Name)
+        }
+    }
+    slices.Sort(names)
+    return names
+}
+
+func TestOTLPTracerExportsTaskTree(t *testing.T) {
+    collector := &testCollector{}
+    server := httptest.NewServer(collector)
+    defer server.Close()
+    tracer := NewOTLPTracer(server.URL + "/v1/traces")
+    exportErrors := make(chan error, 10)
+    tracer.OnError = func(err error) { exportErrors <- err }
+
+    e := newTestEngine(t)
+    e.SetTracer(tracer)
+    if err := e.SpawnWorkers(1); err != nil {
+        t.Fatal(err)
+    }
+    ctx, cancel := context.WithTimeout(context.Background(), 30 * time.Second)
+    defer cancel()
+    defer e.Shutdown(ctx)
+    task, err := e.Schedule(newTestJob(2))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if job, err := task.Wait(ctx); err != nil || job.Status != ST_ACCEPTED {
+        t.Fatalf("job finished with %v, %v", job.Status, err)
+    }
+
+    // 1 task, 1 queue, 1 compile, 2 cases, each with 1 run & 1 judge
+    const total = 9
+    var spans []exportedSpan
+    for {
+        if err := tracer.Flush(ctx); err != nil {
+            t.Fatal(err)
+        }
+        if spans = collector.snapshot(); len(spans) >= total {
+            break
+        }
+        select {
+            case err := <-exportErrors:
+                t.Fatal(err)
+            case <-ctx.Done():
+                t.Fatalf("only %d of %d spans exported", len(spans), total)
+            case <-time.After(10 * time.Millisecond):
+        }
+    }
+    if len(spans) != total {
+        t.Fatalf("expected %d spans, got %d", total, len(spans))
+    }
+
+    var roots []exportedSpan
+    for _, s := range spans {
+        if s.ParentSpanId == "" {
+            roots = append(roots, s)
+        }
+    }
+    if len(roots) != 1 || roots[0].Name != "isfj.task" {
+        t.Fatalf("expected a single isfj.task root, got %v", roots)
+    }
+    root := roots[0]
+    expected := []string{ "isfj.case", "isfj.case", "isfj.compile", "isfj.queue" }
+    if names := childNames(spans, root); !slices.Equal(names, expected) {
+        t.Errorf("children of isfj.task: expected %v, got %v", expected, names)
+    }
+    for _, s := range spans {
+        if s.TraceId != root.TraceId {
+            t.Errorf("span %s belongs to another trace", s.Name)
+        }
+        if s.Name != "isfj.case" || s.ParentSpanId != root.SpanId {
+            continue
+        }
+        expected := []string{ "isfj.judge", "isfj.run" }
+        if names := childNames(spans, s); !slices.Equal(names, expected) {
+            t.Errorf("children of isfj.case: expected %v, got %v", expected, names)
+        }
+    }
+}
@@ -0,0 +1,156 @@
+package isfj
+
+import (
+    "slices"
+)
+
+// State of a worker.
+type WorkerState uint8
+
+// Identifier of the state.
+func (s WorkerState) Ident() string {
+    switch s {
+        case WS_IDLE:
+            return "WS_IDLE"
+        case WS_COMPILING:
+            return "WS_COMPILING"
+        case WS_RUNNING:
+            return "WS_RUNNING"
+    }
+    panic("All branches already covered.")
+}
+
+// Human-readable string representation.
+func (s WorkerState) String() string {
+    switch s {
+        case WS_IDLE:
+            return "Idle"
+        case WS_COMPILING:
+            return "Compiling"
+        case WS_RUNNING:
+            return "Running"
+    }
+    panic("All branches already covered.")
+}
+
+const (
+    // Waiting for a task.
+    WS_IDLE WorkerState = iota
+    // Compiling case 0 of a task.
+    WS_COMPILING
+    // Running case 1~n of a task.
+    WS_RUNNING
+)
+
+// What a worker is doing, returned by [Engine.Workers].
+type WorkerInfo struct {
+    // Id of the worker, unique in the engine.
+    Id      int
+    State   WorkerState
+    // Id of the task, if not idle.
+    Task    uint64
+    // Indices into [Job.Results] of the cases running.
+    Cases   []int
+    // Whether the worker will exit after its current task.
+    Retired bool
+}
+
+func (w *worker) setState(state WorkerState, task uint64) {
+    w.lock.Lock()
+    defer w.lock.Unlock()
+    w.state = state
+    w.task = task
+    w.cases = nil
+}
+
+func (w *worker) startCase(i int) {
+    w.lock.Lock()
+    defer w.lock.Unlock()
+    w.cases = append(w.cases, i)
+}
+
+func (w *worker) finishCase(i int) {
+    w.lock.Lock()
+    defer w.lock.Unlock()
+    w.cases = slices.DeleteFunc(w.cases, func(c int) bool { return c == i })
+}
+
+// Must be called with w.engine.lock held.
+func (w *worker) info() WorkerInfo {
+    w.lock.Lock()
+    defer w.lock.Unlock()
+    cases := slices.Clone(w.cases)
+    slices.Sort(cases)
+    return WorkerInfo{
+        Id: w.id,
+        State: w.state,
+        Task: w.task,
+        Cases: cases,
+        Retired: w.retired,
+    }
+}
+
+// Lists what every worker is doing, including retired workers
+// which are finishing their current tasks.
+func (e *Engine) Workers() []WorkerInfo {
+    e.lock.Lock()
+    defer e.lock.Unlock()
+    infos := make([]WorkerInfo, 0, len(e.workers))
+    for _, w := range e.workers {
+        infos = append(infos, w.info())
+    }
+    return infos
+}
+
+// Number of workers, excluding retired ones.
+func (e *Engine) WorkerCount() int {
+    e.lock.Lock()
+    defer e.lock.Unlock()
+    n := 0
+    for _, w := range e.workers {
+        if !w.retired {
+            n++
+        }
+    }
+    return n
+}
+
+// Spawns or retires workers, so that there are n workers.
+// Idle workers are retired first. Busy workers being retired
+// exit after finishing their current tasks.
+// Returns [ErrNegativeWorkers] if n is negative.
+func (e *Engine) SetWorkers(n int) error {
+    if n < 0 {
+        return ErrNegativeWorkers
+    }
+    current := e.WorkerCount()
+    if n > current {
+        return e.SpawnWorkers(n - current)
+    }
+    e.lock.Lock()
+    defer e.lock.Unlock()
+    candidates := slices.DeleteFunc(slices.Clone(e.workers), func(w *worker) bool { return w.retired })
+    // idle first, then the newest
+    slices.SortStableFunc(candidates, func(a, b *worker) int {
+        aIdle, bIdle := a.info().State == WS_IDLE, b.info().State == WS_IDLE
+        if aIdle != bIdle {
+            if aIdle {
+                return -1
+            }
+            return 1
+        }
+        return b.id - a.id
+    })
+    for _, w := range candidates[:max(len(candidates) - n, 0)] {
+        w.retired = true
+    }
+    e.notify()
+    return nil
+}
+
+// Called by a worker when it exits.
+func (e *Engine) removeWorker(w *worker) {
+    e.lock.Lock()
+    defer e.lock.Unlock()
+    e.workers = slices.DeleteFunc(e.workers, func(x *worker) bool { return x == w })
+}